@@ -0,0 +1,462 @@
+package rapport
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/luma/pith/keys"
+	"github.com/luma/pith/rapport/marshalling"
+)
+
+var (
+	// MapKeysKey is the sigil used to deliminate a key that is for a map's keys
+	MapKeysKey = []byte("K")
+
+	// MapFieldsKey is the sigil used to deliminate a key that is for a map's
+	// field values
+	MapFieldsKey = []byte("F")
+)
+
+// AWMap is a Add-Wins Map. The keys of the map follow the same add-wins
+// semantics as an AWSet and the value of each key, or field, is itself a
+// rapport Value. Fields are merged with the field of the same key in the
+// other map.
+//
+// A field can be any Value whose type has been registered with RegisterType,
+// including a nested AWMap.
+//
+// Removing a key resets it's field if the field is a Resetter, otherwise the
+// field's state is discarded. A reset field is kept, although it's hidden
+// until it's key is updated again, so that merging state from a replica that
+// hadn't seen the remove doesn't bring back what the remove observed. If a key
+// is updated concurrently with being removed then the update wins and, for a
+// reset field, only the concurrent updates are kept. This is the reset-remove
+// semantics of Riak's maps.
+//
+// If two replicas concurrently put fields of different types under the same
+// key then one of them is picked deterministically when they are merged.
+//
+type AWMap struct {
+	keys *AWSet
+
+	// fields holds the field of every key, and the reset fields of keys that
+	// have been removed
+	fields map[string]Value
+	l      sync.RWMutex
+}
+
+// CreateAWMap returns a new, empty AWMap.
+//
+func CreateAWMap() *AWMap {
+	return &AWMap{
+		keys:   CreateAWSet(),
+		fields: make(map[string]Value),
+	}
+}
+
+// Put adds key to the map for a specific replica. If the map does not have a
+// field for key then value becomes it's field, otherwise value is merged into
+// the existing field, or the reset field of a removed key. An error is
+// returned if value is not a supported field type, or is a different type to
+// the existing field.
+//
+// A removed key should be re-added with Update instead, merging a new value
+// with a reset field loses the value's updates that the reset has observed.
+//
+func (m *AWMap) Put(key string, replica string, value Value) error {
+	if _, err := TypeOf(value); err != nil {
+		return err
+	}
+
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	existing, exists := m.fields[key]
+	if !exists {
+		m.fields[key] = value
+	} else if err := mergeField(existing, value); err != nil {
+		if m.keys.Contains(key) {
+			return err
+		}
+
+		// The key has been removed, so it's reset field can be replaced
+		m.fields[key] = value
+	}
+
+	m.keys.AddOne(key, replica)
+	return nil
+}
+
+// Update calls fn with the field for key so that it can be mutated by a
+// specific replica. If key has been removed, but it's field was reset, then
+// fn is called with the reset field and key is added back to the map. It
+// returns an error if the map does not have a field for key.
+//
+func (m *AWMap) Update(key string, replica string, fn func(Value)) error {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	field, exists := m.fields[key]
+	if !exists {
+		return fmt.Errorf("Cannot update missing map key: %s", key)
+	}
+
+	BindReplica(field, replica)
+
+	fn(field)
+	m.keys.AddOne(key, replica)
+	return nil
+}
+
+// Remove removes key from the map and resets, or discards, it's field. It
+// returns true if the key was removed, otherwise it returns false.
+//
+func (m *AWMap) Remove(key string) bool {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	if !m.keys.Contains(key) {
+		return false
+	}
+
+	m.removeField(key)
+	return m.keys.RemoveOne(key) != nil
+}
+
+// Reset removes every key from the map, see Remove
+func (m *AWMap) Reset() {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	for _, key := range m.keys.Values() {
+		m.removeField(key)
+	}
+
+	m.keys.Reset()
+}
+
+// Get returns the field for key, or nil if the map does not contain key
+func (m *AWMap) Get(key string) Value {
+	m.l.RLock()
+	defer m.l.RUnlock()
+
+	if !m.keys.Contains(key) {
+		return nil
+	}
+
+	return m.fields[key]
+}
+
+// Contains returns true if the map contains key
+func (m *AWMap) Contains(key string) bool {
+	return m.keys.Contains(key)
+}
+
+// Keys returns the keys in the map
+func (m *AWMap) Keys() []string {
+	return m.keys.Values()
+}
+
+// Cardinality returns the number of keys in the map
+func (m *AWMap) Cardinality() int {
+	return m.keys.Cardinality()
+}
+
+// IsEmpty returns true if the map contains no keys
+func (m *AWMap) IsEmpty() bool {
+	return m.keys.IsEmpty()
+}
+
+// Merge another AWMap into this one
+//
+func (m *AWMap) Merge(crdt CRDT) {
+	other := crdt.(*AWMap)
+
+	m.l.Lock()
+	other.l.RLock()
+
+	defer func() {
+		m.l.Unlock()
+		other.l.RUnlock()
+	}()
+
+	m.keys.Merge(other.keys)
+
+	for key, otherField := range other.fields {
+		// Fields are merged even if their key has been removed, so that the
+		// field is reset by the remove of the other replica
+		if field, exists := m.fields[key]; exists {
+			m.fields[key] = resolveField(field, otherField)
+			continue
+		}
+
+		if _, isResetter := otherField.(Resetter); !isResetter && !m.keys.Contains(key) {
+			continue
+		}
+
+		// A field that can't be copied is left for a later merge
+		if clone, err := cloneField(otherField); err == nil {
+			m.fields[key] = clone
+		}
+	}
+
+	for key, field := range m.fields {
+		if _, isResetter := field.(Resetter); !isResetter && !m.keys.Contains(key) {
+			delete(m.fields, key)
+		}
+	}
+}
+
+// Marshal serialises the map data to bytes. The segments of the keys and of
+// each field are nested under the map's own key suffixes so that a whole
+// document can live under one key prefix.
+//
+func (m *AWMap) Marshal() ([]*Segment, error) {
+	m.l.RLock()
+	defer m.l.RUnlock()
+
+	keySegments, err := m.keys.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]*Segment, 0, 1+len(keySegments)+len(m.fields))
+
+	// The header segment carries no data, but means that the map's segments
+	// always sort before those of it's keys and fields
+	segments = append(segments, &Segment{})
+
+	for _, s := range keySegments {
+		segments = append(segments, &Segment{
+			KeySuffix: keys.Make(MapKeysKey, s.KeySuffix),
+			Value:     s.Value,
+		})
+	}
+
+	for key, field := range m.fields {
+		valueType, err := TypeOf(field)
+		if err != nil {
+			return nil, err
+		}
+
+		fieldSegments, err := field.Marshal()
+		if err != nil {
+			return nil, err
+		}
+
+		prefix := fieldKeyPrefix(key, valueType)
+		for _, s := range fieldSegments {
+			segments = append(segments, &Segment{
+				KeySuffix: keys.Make(MapFieldsKey, prefix, s.KeySuffix),
+				Value:     s.Value,
+			})
+		}
+	}
+
+	return segments, nil
+}
+
+// Unmarshal deserialises the map data from bytes
+func (m *AWMap) Unmarshal(data []*Segment) error {
+	keySegments := make([]*Segment, 0)
+	fieldSegments := make(map[string][]*Segment)
+	fieldTypes := make(map[string]marshalling.ValueType)
+
+	for _, s := range data[1:] {
+		if s.KeySuffix[0] == MapKeysKey[0] {
+			// Strip off the key sigil to get the set's key suffix
+			keySegments = append(keySegments, &Segment{
+				KeySuffix: s.KeySuffix[2:],
+				Value:     s.Value,
+			})
+
+		} else if s.KeySuffix[0] == MapFieldsKey[0] {
+			key, valueType, suffix, err := parseFieldKeySuffix(s.KeySuffix[2:])
+			if err != nil {
+				return err
+			}
+
+			fieldSegments[key] = append(fieldSegments[key], &Segment{
+				KeySuffix: suffix,
+				Value:     s.Value,
+			})
+			fieldTypes[key] = valueType
+
+		} else {
+			return fmt.Errorf("Unexpected key suffix for map: %s", s.KeySuffix)
+		}
+	}
+
+	if len(keySegments) == 0 {
+		return fmt.Errorf("Map data does not contain any keys")
+	}
+
+	mapKeys := CreateAWSet()
+	if err := mapKeys.Unmarshal(keySegments); err != nil {
+		return err
+	}
+
+	fields := make(map[string]Value)
+	for key, segments := range fieldSegments {
+		field, err := CreateValue(fieldTypes[key])
+		if err != nil {
+			return err
+		}
+
+		if err := field.Unmarshal(segments); err != nil {
+			return err
+		}
+
+		fields[key] = field
+	}
+
+	m.l.Lock()
+	m.keys = mapKeys
+	m.fields = fields
+	m.l.Unlock()
+
+	return nil
+}
+
+// removeField resets the field for key, or discards it if it can't be reset
+//
+// This method is not thread safe
+//
+func (m *AWMap) removeField(key string) {
+	if resetter, isResetter := m.fields[key].(Resetter); isResetter {
+		resetter.Reset()
+	} else {
+		delete(m.fields, key)
+	}
+}
+
+// replicaBinder is implemented by fields that are bound to a specific replica
+// when they are created, so that they can be mutated by whichever replica
+// updates the map.
+type replicaBinder interface {
+	bindReplica(replica string)
+}
+
+func (p *PNCounter) bindReplica(replica string) {
+	p.l.Lock()
+	p.replicaId = replica
+	p.l.Unlock()
+}
+
+func (g *GCounter) bindReplica(replica string) {
+	g.l.Lock()
+	g.replicaId = replica
+	g.l.Unlock()
+}
+
+// cloneField returns a deep-copy of a map field
+func cloneField(field Value) (Value, error) {
+	if register, ok := field.(*LWWRegister); ok {
+		// Merging into an empty register would compare the zero time with the
+		// register's, so copy it directly.
+		return &LWWRegister{
+			t:     register.t,
+			value: register.value,
+			ts:    register.ts,
+		}, nil
+	}
+
+	valueType, err := TypeOf(field)
+	if err != nil {
+		return nil, err
+	}
+
+	// Round trip the field, rather than merging it into an empty one, so that
+	// settings like a LWWElementSet's bias are copied too.
+	segments, err := field.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	clone, err := CreateValue(valueType)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := clone.Unmarshal(segments); err != nil {
+		return nil, err
+	}
+
+	return clone, nil
+}
+
+// mergeField merges other into field, provided they are the same type
+func mergeField(field Value, other Value) error {
+	if reflect.TypeOf(field) != reflect.TypeOf(other) {
+		return fmt.Errorf("Cannot merge map fields of different types: %T and %T", field, other)
+	}
+
+	field.Merge(other)
+	return nil
+}
+
+// resolveField merges other into field and returns the result. Fields of
+// different types can only come from concurrent Puts, so the field whose type
+// wins, see fieldTypeWins, is kept and the other is discarded.
+//
+func resolveField(field Value, other Value) Value {
+	if err := mergeField(field, other); err == nil {
+		return field
+	}
+
+	if !fieldTypeWins(other, field) {
+		return field
+	}
+
+	if clone, err := cloneField(other); err == nil {
+		return clone
+	}
+
+	return field
+}
+
+// fieldTypeWins indicates whether a's type wins over b's when two replicas
+// have fields of different types for the same key. The higher ValueType wins,
+// and the Go type name breaks any ties, so every replica picks the same field.
+//
+func fieldTypeWins(a Value, b Value) bool {
+	aType, _ := TypeOf(a)
+	bType, _ := TypeOf(b)
+	if aType != bType {
+		return aType > bType
+	}
+
+	return fmt.Sprintf("%T", a) > fmt.Sprintf("%T", b)
+}
+
+// fieldKeyPrefix encodes a field's key and ValueType so that they can be
+// recovered from a nested key suffix, even if the key contains separators.
+func fieldKeyPrefix(key string, valueType marshalling.ValueType) []byte {
+	prefix := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(key)+1)
+	n := binary.PutUvarint(prefix, uint64(len(key)))
+	prefix = append(prefix[:n], key...)
+	return append(prefix, byte(valueType))
+}
+
+// parseFieldKeySuffix is the inverse of the nesting done by Marshal, it returns
+// the field's key, it's ValueType and the field's own key suffix.
+func parseFieldKeySuffix(data []byte) (string, marshalling.ValueType, []byte, error) {
+	keyLen, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < keyLen+1 {
+		return "", 0, nil, fmt.Errorf("Malformed key suffix for map field: %s", data)
+	}
+
+	data = data[n:]
+	key := string(data[:keyLen])
+	valueType := marshalling.ValueType(data[keyLen])
+
+	// Skip over the separator between the prefix and the field's own suffix
+	suffix := data[keyLen+1:]
+	if len(suffix) > 0 {
+		suffix = suffix[1:]
+	}
+
+	return key, valueType, suffix, nil
+}
@@ -0,0 +1,319 @@
+package rapport_test
+
+import (
+	"sort"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/luma/pith/rapport"
+)
+
+var _ = Describe("AWMap", func() {
+	var m *AWMap
+
+	JustBeforeEach(func() {
+		m = CreateAWMap()
+		Expect(m.Put("counter", "replica1", CreatePNCounter("replica1"))).To(Succeed())
+	})
+
+	incr := func(amount int64) func(Value) {
+		return func(v Value) {
+			v.(*PNCounter).IncrBy(amount)
+		}
+	}
+
+	visit := func(amount int64) func(Value) {
+		return func(v Value) {
+			v.(*ResettableCounter).IncrBy(amount)
+		}
+	}
+
+	visits := func(m *AWMap) int64 {
+		return m.Get("visits").(*ResettableCounter).Value()
+	}
+
+	Describe("Put()", func() {
+		It("adds the key", func() {
+			Expect(m.Contains("counter")).To(BeTrue())
+			Expect(m.Get("counter")).To(BeAssignableToTypeOf(&PNCounter{}))
+		})
+
+		It("merges into an existing field", func() {
+			counter := CreatePNCounter("replica2")
+			counter.IncrBy(2)
+
+			Expect(m.Put("counter", "replica2", counter)).To(Succeed())
+			Expect(m.Get("counter").(*PNCounter).Value()).To(Equal(int64(2)))
+		})
+
+		It("rejects fields of a different type to the existing field", func() {
+			Expect(m.Put("counter", "replica1", CreateAWSet())).ToNot(Succeed())
+		})
+
+		It("rejects unregistered field types", func() {
+			Expect(m.Put("wut", "replica1", unregisteredValue{CreateAWSet()})).ToNot(Succeed())
+		})
+
+		It("accepts any registered field type", func() {
+			Expect(m.Put("tags", "replica1", CreateORSet())).To(Succeed())
+		})
+	})
+
+	Describe("Update()", func() {
+		It("mutates the field", func() {
+			Expect(m.Update("counter", "replica1", incr(3))).To(Succeed())
+			Expect(m.Get("counter").(*PNCounter).Value()).To(Equal(int64(3)))
+		})
+
+		It("returns an error when the key is missing", func() {
+			Expect(m.Update("wut", "replica1", incr(3))).ToNot(Succeed())
+		})
+	})
+
+	Describe("Remove()", func() {
+		It("removes the key and it's field", func() {
+			Expect(m.Remove("counter")).To(BeTrue())
+			Expect(m.Contains("counter")).To(BeFalse())
+			Expect(m.Get("counter")).To(BeNil())
+		})
+
+		It("resets fields that can be reset, so that they can be updated again", func() {
+			Expect(m.Put("visits", "replica1", CreateResettableCounter("replica1"))).To(Succeed())
+			Expect(m.Update("visits", "replica1", visit(5))).To(Succeed())
+
+			Expect(m.Remove("visits")).To(BeTrue())
+			Expect(m.Contains("visits")).To(BeFalse())
+			Expect(m.Get("visits")).To(BeNil())
+
+			Expect(m.Update("visits", "replica1", visit(2))).To(Succeed())
+			Expect(m.Contains("visits")).To(BeTrue())
+			Expect(visits(m)).To(Equal(int64(2)))
+		})
+
+		It("discards fields that can't be reset", func() {
+			m.Remove("counter")
+			Expect(m.Update("counter", "replica1", incr(1))).ToNot(Succeed())
+		})
+	})
+
+	Describe("Merge()", func() {
+		var m2 *AWMap
+
+		JustBeforeEach(func() {
+			m2 = CreateAWMap()
+		})
+
+		It("adds fields from the other map", func() {
+			set := CreateAWSet()
+			set.Add([]string{"foo", "bar"}, "replica2")
+			m2.Put("set", "replica2", set)
+
+			m.Merge(m2)
+
+			keys := m.Keys()
+			sort.Strings(keys)
+			Expect(keys).To(Equal([]string{"counter", "set"}))
+			Expect(m.Get("set").(*AWSet).Cardinality()).To(Equal(2))
+		})
+
+		It("merges fields that exist in both maps", func() {
+			m.Update("counter", "replica1", incr(2))
+			m2.Merge(m)
+			m2.Update("counter", "replica2", incr(5))
+			m.Update("counter", "replica1", incr(1))
+
+			m.Merge(m2)
+			m2.Merge(m)
+
+			Expect(m.Get("counter").(*PNCounter).Value()).To(Equal(int64(8)))
+			Expect(m2.Get("counter").(*PNCounter).Value()).To(Equal(int64(8)))
+		})
+
+		It("propagates removes", func() {
+			m2.Merge(m)
+			m2.Remove("counter")
+
+			m.Merge(m2)
+
+			Expect(m.Contains("counter")).To(BeFalse())
+			Expect(m.Get("counter")).To(BeNil())
+		})
+
+		It("keeps keys that were updated concurrently with a remove", func() {
+			m2.Merge(m)
+			m2.Remove("counter")
+			m.Update("counter", "replica1", incr(4))
+
+			m.Merge(m2)
+			m2.Merge(m)
+
+			Expect(m.Contains("counter")).To(BeTrue())
+			Expect(m2.Contains("counter")).To(BeTrue())
+			Expect(m2.Get("counter").(*PNCounter).Value()).To(Equal(int64(4)))
+		})
+
+		It("clears counter fields that are reset with Update", func() {
+			Expect(m.Put("visits", "replica1", CreateResettableCounter("replica1"))).To(Succeed())
+			m.Update("visits", "replica1", func(v Value) { v.(*ResettableCounter).IncrBy(5) })
+			m2.Merge(m)
+
+			m2.Update("visits", "replica2", func(v Value) { v.(*ResettableCounter).Reset() })
+			m.Update("visits", "replica1", func(v Value) { v.(*ResettableCounter).Incr() })
+
+			m.Merge(m2)
+			m2.Merge(m)
+
+			Expect(m.Get("visits").(*ResettableCounter).Value()).To(Equal(int64(1)))
+			Expect(m2.Get("visits").(*ResettableCounter).Value()).To(Equal(int64(1)))
+		})
+
+		It("resets the state of removed fields that the remove observed", func() {
+			Expect(m.Put("visits", "replica1", CreateResettableCounter("replica1"))).To(Succeed())
+			m.Update("visits", "replica1", visit(5))
+			m2.Merge(m)
+
+			m.Remove("visits")
+			m2.Update("visits", "replica2", visit(1))
+
+			m.Merge(m2)
+			m2.Merge(m)
+
+			Expect(m.Contains("visits")).To(BeTrue())
+			Expect(visits(m)).To(Equal(int64(1)))
+			Expect(visits(m2)).To(Equal(int64(1)))
+		})
+
+		It("doesn't bring back the elements of removed sets", func() {
+			set := CreateAWSet()
+			set.Add([]string{"foo", "bar"}, "replica1")
+			Expect(m.Put("tags", "replica1", set)).To(Succeed())
+			m2.Merge(m)
+
+			m.Remove("tags")
+			m2.Update("tags", "replica2", func(v Value) { v.(*AWSet).AddOne("baz", "replica2") })
+
+			m.Merge(m2)
+			m2.Merge(m)
+
+			Expect(m.Get("tags").(*AWSet).Values()).To(Equal([]string{"baz"}))
+			Expect(m2.Get("tags").(*AWSet).Values()).To(Equal([]string{"baz"}))
+		})
+
+		It("converges when a removed field is recreated", func() {
+			Expect(m.Put("visits", "replica1", CreateResettableCounter("replica1"))).To(Succeed())
+			m.Update("visits", "replica1", visit(5))
+			m2.Merge(m)
+
+			m.Remove("visits")
+			m.Update("visits", "replica1", visit(2))
+
+			m.Merge(m2)
+			m2.Merge(m)
+
+			Expect(visits(m)).To(Equal(int64(2)))
+			Expect(visits(m2)).To(Equal(int64(2)))
+		})
+
+		It("merges a field that's put after a remove with the reset field", func() {
+			Expect(m.Put("visits", "replica1", CreateResettableCounter("replica1"))).To(Succeed())
+			m.Update("visits", "replica1", visit(5))
+			m.Remove("visits")
+
+			// The reset has observed more increments from replica1 than the new
+			// counter has, which is why a removed key should be re-added with
+			// Update instead
+			counter := CreateResettableCounter("replica1")
+			counter.IncrBy(2)
+			Expect(m.Put("visits", "replica1", counter)).To(Succeed())
+			Expect(visits(m)).To(Equal(int64(0)))
+
+			Expect(m.Update("visits", "replica1", visit(2))).To(Succeed())
+			Expect(visits(m)).To(Equal(int64(2)))
+		})
+
+		It("picks the same field when replicas put fields of different types", func() {
+			Expect(m2.Put("counter", "replica2", CreateAWSet())).To(Succeed())
+
+			Expect(func() { m.Merge(m2) }).ToNot(Panic())
+			Expect(func() { m2.Merge(m) }).ToNot(Panic())
+
+			Expect(m.Get("counter")).To(BeAssignableToTypeOf(&AWSet{}))
+			Expect(m2.Get("counter")).To(BeAssignableToTypeOf(&AWSet{}))
+		})
+
+		It("merges nested maps", func() {
+			nested := CreateAWMap()
+			nested.Put("name", "replica1", CreateLWWRegister("foo"))
+			m.Put("doc", "replica1", nested)
+			m2.Merge(m)
+
+			nested2 := CreateAWMap()
+			nested2.Put("tags", "replica2", CreateAWSet())
+			m2.Put("doc", "replica2", nested2)
+
+			m.Merge(m2)
+
+			keys := m.Get("doc").(*AWMap).Keys()
+			sort.Strings(keys)
+			Expect(keys).To(Equal([]string{"name", "tags"}))
+		})
+	})
+
+	Describe("Marshal()", func() {
+		It("round trips through Unmarshal()", func() {
+			m.Update("counter", "replica1", incr(3))
+
+			nested := CreateAWMap()
+			nested.Put("name", "replica1", CreateLWWRegister("foo"))
+			set := CreateAWSet()
+			set.Add([]string{"foo", "bar"}, "replica1")
+			nested.Put("tags", "replica1", set)
+			m.Put("doc", "replica1", nested)
+
+			segments, err := m.Marshal()
+			Expect(err).ToNot(HaveOccurred())
+
+			m2 := CreateAWMap()
+			Expect(m2.Unmarshal(segments)).To(Succeed())
+
+			keys := m2.Keys()
+			sort.Strings(keys)
+			Expect(keys).To(Equal([]string{"counter", "doc"}))
+			Expect(m2.Get("counter").(*PNCounter).Value()).To(Equal(int64(3)))
+
+			doc := m2.Get("doc").(*AWMap)
+			Expect(doc.Get("name").(*LWWRegister).Get()).To(Equal("foo"))
+
+			tags := doc.Get("tags").(*AWSet).Values()
+			sort.Strings(tags)
+			Expect(tags).To(Equal([]string{"bar", "foo"}))
+		})
+
+		It("keeps the reset fields of removed keys", func() {
+			Expect(m.Put("visits", "replica1", CreateResettableCounter("replica1"))).To(Succeed())
+			m.Update("visits", "replica1", visit(5))
+			m.Remove("visits")
+
+			segments, err := m.Marshal()
+			Expect(err).ToNot(HaveOccurred())
+
+			m2 := CreateAWMap()
+			Expect(m2.Unmarshal(segments)).To(Succeed())
+			Expect(m2.Contains("visits")).To(BeFalse())
+
+			Expect(m2.Update("visits", "replica1", visit(1))).To(Succeed())
+			Expect(visits(m2)).To(Equal(int64(1)))
+		})
+
+		It("nests the segments of each field under the map's key suffixes", func() {
+			segments, err := m.Marshal()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(segments[0].KeySuffix).To(BeEmpty())
+			for _, s := range segments[1:] {
+				Expect(string(s.KeySuffix[0])).To(BeElementOf("K", "F"))
+			}
+		})
+	})
+})
@@ -16,32 +16,60 @@ var (
 	DeferredKey = []byte("D")
 )
 
-// AWSet is a Add-Wins Set. AKA An addition-based, OR-set without tombstones,
+// AWSetOf is a Add-Wins Set. AKA An addition-based, OR-set without tombstones,
 // ORSWOT is harder to type though.
 //
+// Elements can be of any comparable type, the ElementCodec is used to encode
+// them in the set's segment key suffixes.
+//
 // This was ported from riak_dt
 //
-type AWSet struct {
+type AWSetOf[T comparable] struct {
 	Version  *causality.VersionVector
-	entries  map[string]*causality.VersionVector
+	entries  map[T]*causality.VersionVector
 	deferred DeferredMap
+	codec    ElementCodec[T]
 	l        sync.RWMutex
+
+	// isDelta indicates that this set is a delta-group, see CreateAWSetDelta
+	isDelta bool
+
+	// dirty are the values whose entries have changed, and flushedDeferred
+	// the key suffixes of the deferreds, since the changes were last
+	// committed, see MarshalChanges
+	dirty           map[T]struct{}
+	deferredDirty   bool
+	flushedDeferred map[string]struct{}
 }
 
+// AWSet is an AWSetOf strings
+type AWSet = AWSetOf[string]
+
 // CreateAWSet returns a new, empty AWSet.
 //
 func CreateAWSet() *AWSet {
-	return &AWSet{
+	return CreateAWSetOf[string](StringCodec)
+}
+
+// CreateAWSetOf returns a new, empty AWSetOf elements that are encoded with
+// codec.
+//
+func CreateAWSetOf[T comparable](codec ElementCodec[T]) *AWSetOf[T] {
+	return &AWSetOf[T]{
 		Version:  causality.CreateVersionVector(),
-		entries:  make(map[string]*causality.VersionVector),
+		entries:  make(map[T]*causality.VersionVector),
 		deferred: make(DeferredMap),
+		codec:    codec,
+
+		dirty:           make(map[T]struct{}),
+		flushedDeferred: make(map[string]struct{}),
 	}
 }
 
 // AddOne adds a single element to the set for a specific replica. It returns
 // true if the element was added, otherwise it returns false.
 //
-func (a *AWSet) AddOne(value string, replica string) bool {
+func (a *AWSetOf[T]) AddOne(value T, replica string) bool {
 	newTime := a.Version.Incr(replica)
 	entry := causality.CreateVersionVector()
 	entry.Witness(replica, newTime)
@@ -49,6 +77,7 @@ func (a *AWSet) AddOne(value string, replica string) bool {
 	a.l.Lock()
 	_, alreadyExists := a.entries[value]
 	a.entries[value] = entry
+	a.dirty[value] = struct{}{}
 	a.l.Unlock()
 
 	return !alreadyExists
@@ -57,7 +86,7 @@ func (a *AWSet) AddOne(value string, replica string) bool {
 // Add adds multiple elements to the set for a specific replica. It returns the
 // number of elements that were added.
 //
-func (a *AWSet) Add(values []string, replica string) int {
+func (a *AWSetOf[T]) Add(values []T, replica string) int {
 	added := 0
 
 	for _, value := range values {
@@ -72,18 +101,35 @@ func (a *AWSet) Add(values []string, replica string) int {
 // RemoveOne removes a single element from the set by value. It returns the
 // VersionVector of the element that was removed.
 //
-func (a *AWSet) RemoveOne(value string) *causality.VersionVector {
+func (a *AWSetOf[T]) RemoveOne(value T) *causality.VersionVector {
 	a.l.Lock()
-	version := a.entries[value]
-	delete(a.entries, value)
+	version, exists := a.entries[value]
+	if exists {
+		delete(a.entries, value)
+		a.dirty[value] = struct{}{}
+	}
 	a.l.Unlock()
 	return version
 }
 
+// Reset removes every element from the set. Elements that other replicas add
+// concurrently are kept when the sets are merged.
+//
+func (a *AWSetOf[T]) Reset() {
+	a.l.Lock()
+	defer a.l.Unlock()
+
+	for value := range a.entries {
+		a.dirty[value] = struct{}{}
+	}
+
+	a.entries = make(map[T]*causality.VersionVector)
+}
+
 // Remove removes a number of values from the set and returns the number
 // of elements that were removed.
 //
-func (a *AWSet) Remove(values []string) int {
+func (a *AWSetOf[T]) Remove(values []T) int {
 	removed := 0
 
 	for _, value := range values {
@@ -98,7 +144,7 @@ func (a *AWSet) Remove(values []string) int {
 // RemoveOneWithContext removes a values using a witnessing context. It returns
 // the VersionVector of the element that was removed.
 //
-func (a *AWSet) RemoveOneWithContext(value string, context *causality.VersionVector) *causality.VersionVector {
+func (a *AWSetOf[T]) RemoveOneWithContext(value T, context *causality.VersionVector) *causality.VersionVector {
 	a.l.Lock()
 	defer a.l.Unlock()
 
@@ -110,8 +156,9 @@ func (a *AWSet) RemoveOneWithContext(value string, context *causality.VersionVec
 			deferred = MakeDeferredSet()
 		}
 
-		deferred.Members[value] = true
+		deferred.Members[string(a.codec.Encode(value))] = true
 		a.deferred[context] = deferred
+		a.deferredDirty = true
 	}
 
 	existingContext, exists := a.entries[value]
@@ -121,6 +168,8 @@ func (a *AWSet) RemoveOneWithContext(value string, context *causality.VersionVec
 		return nil
 	}
 
+	a.dirty[value] = struct{}{}
+
 	domVersions := existingContext.Subtract(context)
 	if !domVersions.IsEmpty() {
 		// Re-add any of the versions for which we still dominate context
@@ -133,7 +182,7 @@ func (a *AWSet) RemoveOneWithContext(value string, context *causality.VersionVec
 // RemoveWithContext removes a number of values using a witnessing context.
 // It returns the number of elements that were removed.
 //
-func (a *AWSet) RemoveWithContext(values []string, context *causality.VersionVector) int {
+func (a *AWSetOf[T]) RemoveWithContext(values []T, context *causality.VersionVector) int {
 	removed := 0
 
 	for _, value := range values {
@@ -146,9 +195,9 @@ func (a *AWSet) RemoveWithContext(values []string, context *causality.VersionVec
 }
 
 // Values returns the set elements
-func (a *AWSet) Values() []string {
+func (a *AWSetOf[T]) Values() []T {
 	a.l.RLock()
-	values := make([]string, 0, len(a.entries))
+	values := make([]T, 0, len(a.entries))
 	for value := range a.entries {
 		values = append(values, value)
 	}
@@ -158,17 +207,17 @@ func (a *AWSet) Values() []string {
 }
 
 // Cardinality returns the number of elements in the set
-func (a *AWSet) Cardinality() int {
+func (a *AWSetOf[T]) Cardinality() int {
 	return len(a.entries)
 }
 
 // IsEmpty returns true if the set contains no elements
-func (a *AWSet) IsEmpty() bool {
+func (a *AWSetOf[T]) IsEmpty() bool {
 	return len(a.entries) == 0
 }
 
 // Contains returns true if the value is in the set
-func (a *AWSet) Contains(value string) bool {
+func (a *AWSetOf[T]) Contains(value T) bool {
 	a.l.RLock()
 	_, exists := a.entries[value]
 	a.l.RUnlock()
@@ -177,7 +226,7 @@ func (a *AWSet) Contains(value string) bool {
 }
 
 // Each iterates over the set calling the provided function at each iteraction
-func (a *AWSet) Each(fn func(string)) {
+func (a *AWSetOf[T]) Each(fn func(T)) {
 	a.l.RLock()
 	defer a.l.RUnlock()
 
@@ -187,20 +236,22 @@ func (a *AWSet) Each(fn func(string)) {
 }
 
 // Union returns a new set that is the union between this
-// set and the other
-func (a *AWSet) Union(other Set, replica string) Set {
-	union := CreateAWSet()
+// set and the other. The elements are re-added for replica, so the result
+// doesn't share any causal history with either set, see CausalUnion.
+func (a *AWSetOf[T]) Union(other SetOf[T], replica string) SetOf[T] {
+	union := CreateAWSetOf[T](a.codec)
 	union.Add(a.Values(), replica)
 	union.Add(other.Values(), replica)
 	return union
 }
 
 // Intersect returns a new set that is the intersection between this
-// set and the other
-func (a *AWSet) Intersect(other Set, replica string) Set {
-	intersection := CreateAWSet()
+// set and the other. The elements are re-added for replica, so the result
+// doesn't share any causal history with either set, see CausalIntersect.
+func (a *AWSetOf[T]) Intersect(other SetOf[T], replica string) SetOf[T] {
+	intersection := CreateAWSetOf[T](a.codec)
 
-	a.Each(func(value string) {
+	a.Each(func(value T) {
 		if other.Contains(value) {
 			intersection.AddOne(value, replica)
 		}
@@ -209,8 +260,40 @@ func (a *AWSet) Intersect(other Set, replica string) Set {
 	return intersection
 }
 
+// CausalUnion returns a new set that is the join of this set and the other.
+// Rather than re-adding the elements, the result keeps the entries and the
+// Version of both sets, so it can be merged with either of them later. An
+// element that one set has observed being removed from the other isn't in the
+// union.
+//
+func (a *AWSetOf[T]) CausalUnion(other *AWSetOf[T]) *AWSetOf[T] {
+	union := a.clone()
+	union.Merge(other)
+	return union
+}
+
+// CausalIntersect returns a new set with the elements that are in both this
+// set and the other. Like CausalUnion, it keeps their entries and the Version
+// of both sets. Merging the result into either set removes the elements that
+// weren't in both, as the result has observed them and left them out.
+//
+func (a *AWSetOf[T]) CausalIntersect(other *AWSetOf[T]) *AWSetOf[T] {
+	intersection := a.CausalUnion(other)
+
+	intersection.l.Lock()
+	for value := range intersection.entries {
+		if !a.Contains(value) || !other.Contains(value) {
+			delete(intersection.entries, value)
+			delete(intersection.dirty, value)
+		}
+	}
+	intersection.l.Unlock()
+
+	return intersection
+}
+
 // IsSubsetOf indicates whether this set is a subset of the other
-func (a *AWSet) IsSubsetOf(other Set) bool {
+func (a *AWSetOf[T]) IsSubsetOf(other SetOf[T]) bool {
 	for _, value := range a.Values() {
 		if !other.Contains(value) {
 			return false
@@ -222,8 +305,8 @@ func (a *AWSet) IsSubsetOf(other Set) bool {
 
 // Difference returns a new set that is the difference between this
 // set and the other
-func (a *AWSet) Difference(other Set) []string {
-	diff := make([]string, 0)
+func (a *AWSetOf[T]) Difference(other SetOf[T]) []T {
+	diff := make([]T, 0)
 
 	for _, value := range a.Values() {
 		if !other.Contains(value) {
@@ -236,7 +319,7 @@ func (a *AWSet) Difference(other Set) []string {
 
 // GetEntry returns the VersionVector associated with a specfic set value.
 // If the set does not contain the value then it returns nil.
-func (a *AWSet) GetEntry(value string) *causality.VersionVector {
+func (a *AWSetOf[T]) GetEntry(value T) *causality.VersionVector {
 	a.l.RLock()
 	version := a.entries[value]
 	a.l.RUnlock()
@@ -250,8 +333,17 @@ func (a *AWSet) GetEntry(value string) *causality.VersionVector {
 
 // Merge another AWSet into this one
 //
-func (a *AWSet) Merge(crdt CRDT) {
-	other := crdt.(*AWSet)
+// A delta, or delta-group, only has a version for the dots it carries, so
+// merging it like a full set would remove every other element. They're merged
+// with MergeDelta instead. A delta that has been unmarshalled is no longer
+// known to be one, so it must be passed to MergeDelta directly.
+//
+func (a *AWSetOf[T]) Merge(crdt CRDT) {
+	other := crdt.(*AWSetOf[T])
+	if other.isDelta {
+		a.MergeDelta(other)
+		return
+	}
 
 	a.l.Lock()
 	defer func() {
@@ -259,8 +351,8 @@ func (a *AWSet) Merge(crdt CRDT) {
 		a.applyDeferred()
 	}()
 
-	finalEntries := make(map[string]*causality.VersionVector)
-	otherRemaining := make(map[string]*causality.VersionVector)
+	finalEntries := make(map[T]*causality.VersionVector)
+	otherRemaining := make(map[T]*causality.VersionVector)
 
 	other.l.Lock()
 	for value, version := range other.entries {
@@ -316,32 +408,45 @@ func (a *AWSet) Merge(crdt CRDT) {
 
 	// merge deferred removals
 	for version, otherDeferred := range other.deferred {
-		deferred := a.deferred[version]
+		deferred := a.deferred.Find(version)
 		if deferred == nil {
 			deferred = MakeDeferredSet()
+			a.deferred[version.Clone()] = deferred
 		}
 
 		for removedValue := range otherDeferred.Members {
-			deferred.Members[removedValue] = true
+			if !deferred.Members[removedValue] {
+				deferred.Members[removedValue] = true
+				a.deferredDirty = true
+			}
 		}
-
-		a.deferred[version] = deferred
 	}
 
+	a.markChangedEntries(finalEntries)
 	a.entries = finalEntries
 	a.Version.Merge(other.Version)
 }
 
-func (a *AWSet) applyDeferred() {
+func (a *AWSetOf[T]) applyDeferred() {
+	a.l.Lock()
 	deferredMap := a.deferred.Clone()
+	deferredDirty := a.deferredDirty
 	a.deferred = make(DeferredMap)
+	a.l.Unlock()
+
 	for version, entries := range *deferredMap {
-		a.RemoveWithContext(entries.Values(), version)
+		a.RemoveWithContext(a.decodeMembers(entries), version)
 	}
+
+	// Re-deferring a removal doesn't change the deferreds, so they're only
+	// dirty if some of them were applied
+	a.l.Lock()
+	a.deferredDirty = deferredDirty || !a.deferred.Equal(*deferredMap)
+	a.l.Unlock()
 }
 
 // Marshal serialises the set data to bytes
-func (a *AWSet) Marshal() (data []*Segment, err error) {
+func (a *AWSetOf[T]) Marshal() (data []*Segment, err error) {
 	a.l.RLock()
 
 	segments := make([]*Segment, 0, 1+len(a.entries)+len(a.deferred))
@@ -362,7 +467,7 @@ func (a *AWSet) Marshal() (data []*Segment, err error) {
 		}
 
 		segments = append(segments, &Segment{
-			KeySuffix: keys.Make(EntriesKey, []byte(value)),
+			KeySuffix: keys.Make(EntriesKey, a.codec.Encode(value)),
 			Value:     b,
 		})
 	}
@@ -390,9 +495,9 @@ func (a *AWSet) Marshal() (data []*Segment, err error) {
 }
 
 // Marshal deserialises the set data from bytes
-func (a *AWSet) Unmarshal(data []*Segment) error {
+func (a *AWSetOf[T]) Unmarshal(data []*Segment) error {
 	version := causality.CreateVersionVector()
-	entries := make(map[string]*causality.VersionVector)
+	entries := make(map[T]*causality.VersionVector)
 	deferred := make(DeferredMap)
 
 	a.l.Lock()
@@ -411,7 +516,11 @@ func (a *AWSet) Unmarshal(data []*Segment) error {
 			}
 
 			// Strip off the key sigil and add the entry
-			entryKey := string(s.KeySuffix[2:])
+			entryKey, err := a.codec.Decode(s.KeySuffix[2:])
+			if err != nil {
+				return err
+			}
+
 			entries[entryKey] = entryVersion
 
 		} else if s.KeySuffix[0] == DeferredKey[0] {
@@ -425,6 +534,12 @@ func (a *AWSet) Unmarshal(data []*Segment) error {
 				return err
 			}
 
+			for member := range deferredSet.Members {
+				if _, err := a.codec.Decode([]byte(member)); err != nil {
+					return err
+				}
+			}
+
 			deferred[deferredVersion] = deferredSet
 
 		} else {
@@ -436,5 +551,51 @@ func (a *AWSet) Unmarshal(data []*Segment) error {
 	a.entries = entries
 	a.deferred = deferred
 
+	// The set is now the same as the segments it was loaded from, so there
+	// are no changes to report.
+	a.dirty = make(map[T]struct{})
+	a.deferredDirty = false
+	a.flushedDeferred = make(map[string]struct{})
+	for _, s := range data[1:] {
+		if s.KeySuffix[0] == DeferredKey[0] {
+			a.flushedDeferred[string(s.KeySuffix)] = struct{}{}
+		}
+	}
+
 	return nil
 }
+
+// clone returns a deep-copy of the set. All of the clone's entries are
+// marked as changed, as none of them have been saved.
+//
+func (a *AWSetOf[T]) clone() *AWSetOf[T] {
+	clone := CreateAWSetOf[T](a.codec)
+
+	a.l.RLock()
+	defer a.l.RUnlock()
+
+	clone.Version = a.Version.Clone()
+	for value, version := range a.entries {
+		clone.entries[value] = version.Clone()
+		clone.dirty[value] = struct{}{}
+	}
+
+	clone.deferred = *a.deferred.Clone()
+	clone.deferredDirty = true
+
+	return clone
+}
+
+// decodeMembers returns the elements of a deferred set. Members are checked
+// when they are unmarshalled, so they can always be decoded.
+//
+func (a *AWSetOf[T]) decodeMembers(deferred *DeferredSet) []T {
+	values := make([]T, 0, len(deferred.Members))
+	for member := range deferred.Members {
+		if value, err := a.codec.Decode([]byte(member)); err == nil {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
@@ -0,0 +1,149 @@
+package rapport
+
+import (
+	"github.com/luma/pith/keys"
+	"github.com/luma/pith/rapport/causality"
+)
+
+// ChangeMarshaler is implemented by values that can serialise just the
+// segments that have changed since they were last saved.
+//
+type ChangeMarshaler interface {
+	MarshalChanges() (updated []*Segment, deleted [][]byte, commit func(), err error)
+}
+
+// MarshalChanges serialises only the segments that have changed since the
+// changes were last committed, or since the set was unmarshalled. It returns
+// the segments that were added or modified and the key suffixes of the
+// segments that were deleted. The header segment is always included.
+//
+// The changes remain pending until commit is called, which should only
+// happen once they have been persisted. Changes that are made to the set
+// after MarshalChanges remain pending after commit.
+//
+func (a *AWSetOf[T]) MarshalChanges() (updated []*Segment, deleted [][]byte, commit func(), err error) {
+	a.l.RLock()
+	defer a.l.RUnlock()
+
+	v, err := a.Version.Marshal()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	updated = make([]*Segment, 0, 1+len(a.dirty))
+	deleted = make([][]byte, 0)
+
+	updated = append(updated, &Segment{
+		Value: v,
+	})
+
+	// flushed are the entries as they were marshalled, a nil entry has been
+	// deleted
+	flushed := make(map[T]*causality.VersionVector, len(a.dirty))
+
+	for value := range a.dirty {
+		keySuffix := keys.Make(EntriesKey, a.codec.Encode(value))
+
+		version, exists := a.entries[value]
+		if !exists {
+			flushed[value] = nil
+			deleted = append(deleted, keySuffix)
+			continue
+		}
+
+		b, err := version.Marshal()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		flushed[value] = version.Clone()
+		updated = append(updated, &Segment{
+			KeySuffix: keySuffix,
+			Value:     b,
+		})
+	}
+
+	var flushedDeferred *DeferredMap
+	var current map[string]struct{}
+
+	if a.deferredDirty {
+		flushedDeferred = a.deferred.Clone()
+		current = make(map[string]struct{}, len(a.deferred))
+
+		for version, deferredSet := range a.deferred {
+			v, err := version.Marshal()
+			if err != nil {
+				return nil, nil, nil, err
+			}
+
+			b, err := deferredSet.Marshal()
+			if err != nil {
+				return nil, nil, nil, err
+			}
+
+			keySuffix := keys.Make(DeferredKey, v)
+			current[string(keySuffix)] = struct{}{}
+
+			updated = append(updated, &Segment{
+				KeySuffix: keySuffix,
+				Value:     b,
+			})
+		}
+
+		for keySuffix := range a.flushedDeferred {
+			if _, exists := current[keySuffix]; !exists {
+				deleted = append(deleted, []byte(keySuffix))
+			}
+		}
+	}
+
+	commit = func() {
+		a.l.Lock()
+		defer a.l.Unlock()
+
+		for value, version := range flushed {
+			entry, exists := a.entries[value]
+			if version == nil && !exists || version != nil && exists && entry.Compare(version) == causality.OrderEqual {
+				delete(a.dirty, value)
+			}
+		}
+
+		if flushedDeferred != nil {
+			a.flushedDeferred = current
+			if a.deferred.Equal(*flushedDeferred) {
+				a.deferredDirty = false
+			}
+		}
+	}
+
+	return updated, deleted, commit, nil
+}
+
+// HasChanges indicates whether the set has changed since the changes were
+// last committed, see MarshalChanges.
+//
+func (a *AWSetOf[T]) HasChanges() bool {
+	a.l.RLock()
+	defer a.l.RUnlock()
+
+	return len(a.dirty) > 0 || a.deferredDirty
+}
+
+// markChangedEntries marks the values whose entries differ between the
+// current entries and entries as dirty
+//
+// This method is not thread safe
+//
+func (a *AWSetOf[T]) markChangedEntries(entries map[T]*causality.VersionVector) {
+	for value, version := range a.entries {
+		if other, exists := entries[value]; !exists || other.Compare(version) != causality.OrderEqual {
+			a.dirty[value] = struct{}{}
+		}
+	}
+
+	for value := range entries {
+		if _, exists := a.entries[value]; !exists {
+			a.dirty[value] = struct{}{}
+		}
+	}
+}
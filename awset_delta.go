@@ -0,0 +1,138 @@
+package rapport
+
+import "github.com/luma/pith/rapport/causality"
+
+// CreateAWSetDelta returns a new, empty, AWSet delta-group. Deltas returned
+// by the delta mutators can be joined into it with MergeDelta, so that many
+// mutations can be shipped to another replica at once.
+//
+// Unlike a regular AWSet a delta-group keeps a record of every removal that
+// is merged into it, so that the removals can be applied by the replica that
+// eventually receives the group.
+//
+func CreateAWSetDelta() *AWSet {
+	return CreateAWSetDeltaOf[string](StringCodec)
+}
+
+// CreateAWSetDeltaOf returns a new, empty, AWSetOf delta-group for elements
+// that are encoded with codec.
+//
+func CreateAWSetDeltaOf[T comparable](codec ElementCodec[T]) *AWSetOf[T] {
+	delta := CreateAWSetOf[T](codec)
+	delta.isDelta = true
+	return delta
+}
+
+// AddOneDelta adds a single element to the set for a specific replica, like
+// AddOne, and returns a delta. The delta contains only the new dot and, if the
+// element was already in the set, the context of the dots it replaced.
+//
+// See https://arxiv.org/pdf/1603.01529.pdf
+//
+func (a *AWSetOf[T]) AddOneDelta(value T, replica string) *AWSetOf[T] {
+	newTime := a.Version.Incr(replica)
+	entry := causality.CreateVersionVector()
+	entry.Witness(replica, newTime)
+
+	a.l.Lock()
+	previous := a.entries[value]
+	a.entries[value] = entry
+	a.dirty[value] = struct{}{}
+	a.l.Unlock()
+
+	delta := CreateAWSetDeltaOf[T](a.codec)
+	delta.Version.Witness(replica, newTime)
+	delta.entries[value] = entry.Clone()
+
+	if previous != nil {
+		// The add replaces the existing dots, so other replicas need to remove
+		// them too
+		removed := MakeDeferredSet()
+		removed.Members[string(a.codec.Encode(value))] = true
+		delta.deferred[previous.Clone()] = removed
+	}
+
+	return delta
+}
+
+// RemoveOneDelta removes a single element from the set by value, like
+// RemoveOne, and returns a delta that contains only the context of the dots
+// that were removed. It returns nil if the element wasn't in the set.
+//
+func (a *AWSetOf[T]) RemoveOneDelta(value T) *AWSetOf[T] {
+	version := a.RemoveOne(value)
+	if version == nil {
+		return nil
+	}
+
+	removed := MakeDeferredSet()
+	removed.Members[string(a.codec.Encode(value))] = true
+
+	delta := CreateAWSetDeltaOf[T](a.codec)
+	delta.deferred[version] = removed
+
+	return delta
+}
+
+// MergeDelta joins a delta, or a delta-group, into this set.
+//
+// Deltas only carry the dots they introduced, so they must be merged in the
+// order that each replica produced them. Removals whose context has not been
+// seen yet are deferred until it has, exactly as with Merge.
+//
+func (a *AWSetOf[T]) MergeDelta(delta *AWSetOf[T]) {
+	delta.l.RLock()
+	defer delta.l.RUnlock()
+
+	a.l.Lock()
+	for value, version := range delta.entries {
+		// Only the dots that we haven't seen are new, any others have either
+		// been merged already or have since been removed
+		uniq := version.Subtract(a.Version)
+		if uniq.IsEmpty() {
+			continue
+		}
+
+		entry := a.entries[value]
+		if entry == nil {
+			entry = causality.CreateVersionVector()
+			a.entries[value] = entry
+		}
+
+		entry.Merge(uniq)
+		a.dirty[value] = struct{}{}
+	}
+
+	a.Version.Merge(delta.Version)
+
+	if a.isDelta {
+		// A delta-group keeps every removal so that it can be forwarded
+		for version, removed := range delta.deferred {
+			for _, value := range a.decodeMembers(removed) {
+				if entry := a.entries[value]; entry != nil {
+					if remaining := entry.Subtract(version); remaining.IsEmpty() {
+						delete(a.entries, value)
+					} else {
+						a.entries[value] = remaining
+					}
+
+					a.dirty[value] = struct{}{}
+				}
+			}
+
+			a.deferred[version.Clone()] = removed.Clone()
+			a.deferredDirty = true
+		}
+
+		a.l.Unlock()
+		return
+	}
+
+	a.l.Unlock()
+
+	for version, removed := range delta.deferred {
+		a.RemoveWithContext(a.decodeMembers(removed), version)
+	}
+
+	a.applyDeferred()
+}
@@ -1,6 +1,8 @@
 package rapport_test
 
 import (
+	"encoding/binary"
+	"fmt"
 	"sort"
 
 	. "github.com/onsi/ginkgo"
@@ -8,6 +10,7 @@ import (
 
 	. "github.com/luma/pith/rapport"
 	"github.com/luma/pith/rapport/causality"
+	"github.com/luma/pith/rapport/store"
 )
 
 var _ = Describe("AWSet", func() {
@@ -328,6 +331,116 @@ var _ = Describe("AWSet", func() {
 		})
 	})
 
+	Describe("Deltas", func() {
+		var set2 *AWSet
+
+		JustBeforeEach(func() {
+			set2 = CreateAWSet()
+			set2.Merge(set)
+		})
+
+		It("AddOneDelta() only contains the new dot", func() {
+			set.AddOne("bar", "replica1")
+			delta := set.AddOneDelta("baz", "replica1")
+
+			Expect(delta.Values()).To(Equal([]string{"baz"}))
+
+			t, _ := delta.Version.Get("replica1")
+			Expect(t).To(Equal(causality.LamportTime(3)))
+			Expect(set.Contains("baz")).To(BeTrue())
+		})
+
+		It("RemoveOneDelta() returns nil when the value is not in the set", func() {
+			Expect(set.RemoveOneDelta("wut")).To(BeNil())
+		})
+
+		It("merges add deltas", func() {
+			set2.MergeDelta(set.AddOneDelta("bar", "replica1"))
+			set2.MergeDelta(set.AddOneDelta("baz", "replica1"))
+
+			values := set2.Values()
+			sort.Strings(values)
+			Expect(values).To(Equal([]string{"bar", "baz", "foo"}))
+		})
+
+		It("merges remove deltas", func() {
+			set.AddOne("bar", "replica1")
+			set2.Merge(set)
+
+			set2.MergeDelta(set.RemoveOneDelta("foo"))
+
+			Expect(set2.Values()).To(Equal([]string{"bar"}))
+		})
+
+		It("does not remove elements that were concurrently re-added", func() {
+			delta := set.RemoveOneDelta("foo")
+			set2.AddOne("foo", "replica2")
+
+			set2.MergeDelta(delta)
+
+			Expect(set2.Contains("foo")).To(BeTrue())
+		})
+
+		It("removes the dots that a re-add replaced", func() {
+			set2.AddOne("foo", "replica2")
+			set.Merge(set2)
+			set2.RemoveOne("foo")
+
+			set2.MergeDelta(set.AddOneDelta("foo", "replica1"))
+
+			entry := set2.GetEntry("foo")
+			_, exists := entry.Get("replica2")
+			Expect(exists).To(BeFalse())
+			Expect(set2.Contains("foo")).To(BeTrue())
+		})
+
+		It("defers removes for adds that have not been seen", func() {
+			set3 := CreateAWSet()
+			set3.MergeDelta(set2.RemoveOneDelta("foo"))
+			Expect(set3.Contains("foo")).To(BeFalse())
+
+			set3.Merge(set)
+
+			Expect(set3.Contains("foo")).To(BeFalse())
+		})
+
+		It("merges deltas that are passed to Merge() as deltas", func() {
+			set.AddOne("bar", "replica1")
+			set2.Merge(set)
+
+			set2.Merge(set.AddOneDelta("baz", "replica1"))
+			set2.Merge(set.RemoveOneDelta("foo"))
+
+			values := set2.Values()
+			sort.Strings(values)
+			Expect(values).To(Equal([]string{"bar", "baz"}))
+		})
+
+		It("accumulates deltas into a delta-group", func() {
+			group := CreateAWSetDelta()
+			group.MergeDelta(set.AddOneDelta("bar", "replica1"))
+			group.MergeDelta(set.AddOneDelta("baz", "replica1"))
+			group.MergeDelta(set.RemoveOneDelta("foo"))
+			group.MergeDelta(set.RemoveOneDelta("bar"))
+
+			set2.MergeDelta(group)
+
+			Expect(set2.Values()).To(Equal([]string{"baz"}))
+			Expect(set2.Values()).To(Equal(set.Values()))
+		})
+
+		It("marshals deltas", func() {
+			segments, err := set.RemoveOneDelta("foo").Marshal()
+			Expect(err).ToNot(HaveOccurred())
+
+			delta := CreateAWSet()
+			Expect(delta.Unmarshal(segments)).To(Succeed())
+
+			set2.MergeDelta(delta)
+			Expect(set2.IsEmpty()).To(BeTrue())
+		})
+	})
+
 	Describe("Contains()", func() {
 		It("returns true when the set contains the value", func() {
 			Expect(set.Contains("foo")).To(BeTrue())
@@ -398,6 +511,113 @@ var _ = Describe("AWSet", func() {
 		})
 	})
 
+	Describe("Reset()", func() {
+		It("removes every element, but keeps concurrent adds when merged", func() {
+			set2 := CreateAWSet()
+			set2.Merge(set)
+
+			set.AddOne("bar", "replica1")
+			set.Reset()
+			Expect(set.IsEmpty()).To(BeTrue())
+
+			set2.AddOne("baz", "replica2")
+			set.Merge(set2)
+
+			Expect(set.Values()).To(Equal([]string{"baz"}))
+		})
+	})
+
+	Describe("CausalUnion()", func() {
+		var set2 *AWSet
+
+		JustBeforeEach(func() {
+			set2 = CreateAWSet()
+		})
+
+		It("returns the union of both sets", func() {
+			set.Add([]string{"foo", "bar"}, "replica1")
+			set2.Add([]string{"bar", "baz"}, "replica2")
+
+			values := set.CausalUnion(set2).Values()
+			sort.Strings(values)
+			Expect(values).To(Equal([]string{"bar", "baz", "foo"}))
+		})
+
+		It("keeps the entries and version of both sets", func() {
+			set2.AddOne("bar", "replica2")
+
+			union := set.CausalUnion(set2)
+			Expect(union.GetEntry("foo").Compare(set.GetEntry("foo"))).To(Equal(causality.OrderEqual))
+			Expect(union.GetEntry("bar").Compare(set2.GetEntry("bar"))).To(Equal(causality.OrderEqual))
+
+			t, _ := union.Version.Get("replica1")
+			Expect(t).To(BeEquivalentTo(1))
+			t, _ = union.Version.Get("replica2")
+			Expect(t).To(BeEquivalentTo(1))
+		})
+
+		It("doesn't resurrect removed elements when merged with an input", func() {
+			set.Add([]string{"foo", "bar"}, "replica1")
+			set2.Merge(set)
+			union := set.CausalUnion(set2)
+
+			set.RemoveOne("foo")
+			set.Merge(union)
+
+			Expect(set.Contains("foo")).To(BeFalse())
+			Expect(set.Contains("bar")).To(BeTrue())
+		})
+
+		It("doesn't change either set", func() {
+			set2.AddOne("bar", "replica2")
+
+			set.CausalUnion(set2)
+			Expect(set.Values()).To(Equal([]string{"foo"}))
+			Expect(set2.Values()).To(Equal([]string{"bar"}))
+		})
+	})
+
+	Describe("CausalIntersect()", func() {
+		var set2 *AWSet
+
+		JustBeforeEach(func() {
+			set2 = CreateAWSet()
+		})
+
+		It("returns the intersection of both sets", func() {
+			set.Add([]string{"foo", "bar"}, "replica1")
+			set2.Merge(set)
+			set2.AddOne("baz", "replica2")
+			set.AddOne("wut", "replica1")
+
+			values := set.CausalIntersect(set2).Values()
+			sort.Strings(values)
+			Expect(values).To(Equal([]string{"bar", "foo"}))
+		})
+
+		It("includes elements that were added concurrently to both sets", func() {
+			set.AddOne("foo", "replica1")
+			set2.AddOne("foo", "replica2")
+
+			intersection := set.CausalIntersect(set2)
+			Expect(intersection.Contains("foo")).To(BeTrue())
+
+			_, exists := intersection.GetEntry("foo").Get("replica2")
+			Expect(exists).To(BeTrue())
+		})
+
+		It("doesn't resurrect removed elements when merged with an input", func() {
+			set.Add([]string{"foo", "bar"}, "replica1")
+			set2.Merge(set)
+			intersection := set.CausalIntersect(set2)
+
+			set2.RemoveOne("foo")
+			set2.Merge(intersection)
+
+			Expect(set2.Values()).To(Equal([]string{"bar"}))
+		})
+	})
+
 	Describe("Intersect()", func() {
 		var set2 *AWSet
 
@@ -485,4 +705,226 @@ var _ = Describe("AWSet", func() {
 			Expect(values).To(Equal([]string{"baz", "foo"}))
 		})
 	})
+
+	Describe("MarshalChanges()", func() {
+		var changes func() (updated []string, deleted []string)
+
+		JustBeforeEach(func() {
+			changes = func() (updated []string, deleted []string) {
+				segments, removed, commit, err := set.MarshalChanges()
+				Expect(err).ToNot(HaveOccurred())
+				commit()
+
+				for _, s := range segments {
+					updated = append(updated, string(s.KeySuffix))
+				}
+
+				for _, keySuffix := range removed {
+					deleted = append(deleted, string(keySuffix))
+				}
+
+				return updated, deleted
+			}
+		})
+
+		It("returns every segment the first time", func() {
+			set.Add([]string{"bar", "baz"}, "replica1")
+
+			updated, deleted := changes()
+			Expect(updated).To(HaveLen(4))
+			Expect(deleted).To(BeEmpty())
+		})
+
+		It("only returns the header and the segments that changed since", func() {
+			set.Add([]string{"bar", "baz"}, "replica1")
+			changes()
+			Expect(set.HasChanges()).To(BeFalse())
+
+			set.AddOne("qux", "replica1")
+			set.RemoveOne("bar")
+			Expect(set.HasChanges()).To(BeTrue())
+
+			updated, deleted := changes()
+			Expect(updated).To(HaveLen(2))
+			Expect(updated).To(ContainElement(""))
+			Expect(updated).To(ContainElement(ContainSubstring("qux")))
+			Expect(deleted).To(HaveLen(1))
+			Expect(deleted[0]).To(ContainSubstring("bar"))
+		})
+
+		It("tracks the entries changed by a merge", func() {
+			set.Add([]string{"bar", "baz"}, "replica1")
+
+			set2 := CreateAWSet()
+			set2.Merge(set)
+			set2.AddOne("qux", "replica2")
+			set2.RemoveOne("foo")
+
+			changes()
+			set.Merge(set2)
+
+			updated, deleted := changes()
+			Expect(updated).To(HaveLen(2))
+			Expect(updated).To(ContainElement(ContainSubstring("qux")))
+			Expect(deleted).To(HaveLen(1))
+			Expect(deleted[0]).To(ContainSubstring("foo"))
+		})
+
+		It("keeps the changes until they are committed", func() {
+			set.Add([]string{"bar", "baz"}, "replica1")
+
+			_, _, _, err := set.MarshalChanges()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(set.HasChanges()).To(BeTrue())
+
+			updated, _ := changes()
+			Expect(updated).To(HaveLen(4))
+			Expect(set.HasChanges()).To(BeFalse())
+		})
+
+		It("keeps the changes that were made after they were marshalled", func() {
+			set.Add([]string{"bar", "baz"}, "replica1")
+
+			_, _, commit, err := set.MarshalChanges()
+			Expect(err).ToNot(HaveOccurred())
+
+			set.RemoveOne("bar")
+			commit()
+			Expect(set.HasChanges()).To(BeTrue())
+
+			_, deleted := changes()
+			Expect(deleted).To(HaveLen(1))
+			Expect(deleted[0]).To(ContainSubstring("bar"))
+		})
+
+		It("doesn't mark the deferreds as changed when a merge doesn't change them", func() {
+			context := set.Version.Clone()
+			context.Incr("replica2")
+			set.RemoveOneWithContext("bar", context)
+
+			set2 := CreateAWSet()
+			set2.Merge(set)
+
+			changes()
+			set.Merge(set2)
+			Expect(set.HasChanges()).To(BeFalse())
+		})
+
+		It("has no changes once unmarshalled", func() {
+			segments, err := set.Marshal()
+			Expect(err).ToNot(HaveOccurred())
+
+			loaded := CreateAWSet()
+			Expect(loaded.Unmarshal(segments)).To(Succeed())
+			Expect(loaded.HasChanges()).To(BeFalse())
+		})
+
+		It("keeps a store in sync", func() {
+			s := store.CreateMemoryStore()
+			Expect(SaveChanges(s, []byte("set"), set)).To(Succeed())
+
+			set.Add([]string{"bar", "baz"}, "replica1")
+			set.RemoveOne("foo")
+			Expect(SaveChanges(s, []byte("set"), set)).To(Succeed())
+
+			loaded := CreateAWSet()
+			Expect(LoadValue(s, []byte("set"), loaded)).To(Succeed())
+			Expect(loaded.Values()).To(ConsistOf("bar", "baz"))
+			Expect(loaded.Version.Compare(set.Version)).To(Equal(causality.OrderEqual))
+		})
+
+		It("keeps the changes when they can't be saved", func() {
+			s := store.CreateMemoryStore()
+			Expect(SaveChanges(s, []byte("set"), set)).To(Succeed())
+
+			set.AddOne("bar", "replica1")
+			Expect(s.Close()).To(Succeed())
+			Expect(SaveChanges(s, []byte("set"), set)).To(MatchError(store.ErrClosed))
+			Expect(set.HasChanges()).To(BeTrue())
+
+			updated, _ := changes()
+			Expect(updated).To(ContainElement(ContainSubstring("bar")))
+		})
+	})
+})
+
+type point struct {
+	X, Y int32
+}
+
+var pointCodec = ElementCodecFuncs[point]{
+	EncodeFunc: func(p point) []byte {
+		data := binary.BigEndian.AppendUint32(nil, uint32(p.X))
+		return binary.BigEndian.AppendUint32(data, uint32(p.Y))
+	},
+	DecodeFunc: func(data []byte) (point, error) {
+		if len(data) != 8 {
+			return point{}, fmt.Errorf("Bad point: %x", data)
+		}
+
+		return point{
+			X: int32(binary.BigEndian.Uint32(data[:4])),
+			Y: int32(binary.BigEndian.Uint32(data[4:])),
+		}, nil
+	},
+}
+
+var _ = Describe("AWSetOf", func() {
+	It("stores integer elements", func() {
+		set := CreateAWSetOf[int64](Int64Codec)
+		set.Add([]int64{-5, 0, 42}, "replica1")
+		set.RemoveOne(0)
+
+		segments, err := set.Marshal()
+		Expect(err).ToNot(HaveOccurred())
+
+		loaded := CreateAWSetOf[int64](Int64Codec)
+		Expect(loaded.Unmarshal(segments)).To(Succeed())
+		Expect(loaded.Values()).To(ConsistOf(int64(-5), int64(42)))
+	})
+
+	It("stores composite elements", func() {
+		set := CreateAWSetOf[point](pointCodec)
+		set.AddOne(point{1, 2}, "replica1")
+
+		set2 := CreateAWSetOf[point](pointCodec)
+		set2.AddOne(point{-3, 4}, "replica2")
+		set2.Merge(set)
+
+		set.RemoveOneWithContext(point{1, 2}, set.Version.Clone())
+		set2.Merge(set)
+
+		Expect(set2.Values()).To(ConsistOf(point{-3, 4}))
+		Expect(set2.Contains(point{1, 2})).To(BeFalse())
+	})
+
+	It("supports the set operations", func() {
+		set := CreateAWSetOf[int64](Int64Codec)
+		set.Add([]int64{1, 2, 3}, "replica1")
+
+		set2 := CreateAWSetOf[int64](Int64Codec)
+		set2.Add([]int64{2, 3, 4}, "replica1")
+
+		Expect(set.Intersect(set2, "replica1").Values()).To(ConsistOf(int64(2), int64(3)))
+		Expect(set.Union(set2, "replica1").Cardinality()).To(Equal(4))
+		Expect(set.Difference(set2)).To(Equal([]int64{1}))
+	})
+
+	It("rejects segments that can't be decoded", func() {
+		set := CreateAWSet()
+		set.AddOne("nope", "replica1")
+
+		segments, err := set.Marshal()
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(CreateAWSetOf[int64](Int64Codec).Unmarshal(segments)).ToNot(Succeed())
+	})
+
+	It("encodes int64s in numeric order", func() {
+		Expect(string(Int64Codec.Encode(-1)) < string(Int64Codec.Encode(1))).To(BeTrue())
+
+		value, err := Int64Codec.Decode(Int64Codec.Encode(-12345))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(value).To(Equal(int64(-12345)))
+	})
 })
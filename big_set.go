@@ -0,0 +1,711 @@
+package rapport
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/luma/pith/keys"
+	"github.com/luma/pith/rapport/causality"
+	"github.com/luma/pith/rapport/store"
+)
+
+// BigSetBatchSize is the most changes that merging a BigSet writes to the
+// store in a single batch, so that merging two large sets doesn't need memory
+// for all of their differences at once.
+//
+var BigSetBatchSize = 1000
+
+// SegmentIterator iterates over a stream of Segments, sorted by KeySuffix
+//
+//  it, err := set.Segments()
+//  ...
+//  defer it.Close()
+//
+//  for it.Next() {
+//    fmt.Println(it.Segment())
+//  }
+//
+//  if err := it.Err(); err != nil {
+//    ...
+//  }
+//
+type SegmentIterator interface {
+	// Next moves to the next segment, it returns false when there are no more
+	Next() bool
+
+	// Segment returns the current segment
+	Segment() *Segment
+
+	// Err returns any error that stopped the iteration
+	Err() error
+
+	// Close releases the iterator
+	Close() error
+}
+
+// BigSetOf is a Add-Wins Set that lives in a Store rather than in memory. The
+// set's Version Vector, and the dots of each element, are kept under separate
+// keys so that reading and writing an element never needs the whole set to be
+// loaded. Iterating the set scans the store lazily, and merging streams the
+// sorted segments of both sets one element at a time and writes the changes
+// in bounded batches, so neither needs memory for the whole set.
+//
+// The set is only kept out of memory if the Store is. MemoryStore and
+// FileStore hold their whole keyspace in memory, only a Store that keeps it
+// on disk allows the set to be bigger than memory.
+//
+// The segments are laid out like those of an AWSetOf, so a BigSet can be merged
+// with the segments of an AWSet and loaded into one with LoadValue. Removals
+// that an AWSet deferred are kept as deferred segments, which are held in
+// memory while merging, until the set has witnessed their context.
+//
+// See https://syncfree.lip6.fr/index.php/2-uncategorised/53-big-sets
+//
+type BigSetOf[T comparable] struct {
+	store store.Store
+	key   []byte
+	codec ElementCodec[T]
+
+	// l serialises changes to the set, reads go straight to the store
+	l sync.Mutex
+}
+
+// BigSet is a BigSetOf strings
+type BigSet = BigSetOf[string]
+
+// CreateBigSet returns a BigSet that is stored under key in s.
+//
+func CreateBigSet(s store.Store, key []byte) *BigSet {
+	return CreateBigSetOf[string](s, key, StringCodec)
+}
+
+// CreateBigSetOf returns a BigSetOf elements, that are encoded with codec, and
+// that is stored under key in s.
+//
+func CreateBigSetOf[T comparable](s store.Store, key []byte, codec ElementCodec[T]) *BigSetOf[T] {
+	return &BigSetOf[T]{
+		store: s,
+		key:   key,
+		codec: codec,
+	}
+}
+
+// Version returns the Version Vector of the set
+func (b *BigSetOf[T]) Version() (*causality.VersionVector, error) {
+	data, err := b.store.Get(SegmentKey(b.key, nil))
+	if err == store.ErrNotFound {
+		return causality.CreateVersionVector(), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return causality.UnmarshalVersionVector(data)
+}
+
+// AddOne adds a single element to the set for a specific replica
+func (b *BigSetOf[T]) AddOne(value T, replica string) error {
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	version, err := b.Version()
+	if err != nil {
+		return err
+	}
+
+	newTime := version.Incr(replica)
+	entry := causality.CreateVersionVector()
+	entry.Witness(replica, newTime)
+
+	v, err := version.Marshal()
+	if err != nil {
+		return err
+	}
+
+	e, err := entry.Marshal()
+	if err != nil {
+		return err
+	}
+
+	batch := store.CreateBatch()
+	batch.Put(b.entryKey(value), e)
+	batch.Put(SegmentKey(b.key, nil), v)
+	return b.store.Write(batch)
+}
+
+// RemoveOne removes a single element from the set by value. It returns true if
+// the element was removed, otherwise it returns false.
+//
+func (b *BigSetOf[T]) RemoveOne(value T) (bool, error) {
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	key := b.entryKey(value)
+	if _, err := b.store.Get(key); err == store.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if err := b.store.Delete(key); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Contains returns true if value is in the set. Only the element's own key is
+// read.
+//
+func (b *BigSetOf[T]) Contains(value T) (bool, error) {
+	_, err := b.store.Get(b.entryKey(value))
+	if err == store.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Values returns an iterator over the elements of the set, in the order of
+// their encoded form. The iterator must be closed once it's no longer needed.
+//
+func (b *BigSetOf[T]) Values() (*BigSetIterator[T], error) {
+	prefix := SegmentKey(b.key, keys.Make(EntriesKey, nil))
+	it, err := b.store.Scan(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BigSetIterator[T]{
+		it:        it,
+		prefixLen: len(prefix),
+		codec:     b.codec,
+	}, nil
+}
+
+// Cardinality returns the number of elements in the set. The elements are
+// counted by scanning them.
+//
+func (b *BigSetOf[T]) Cardinality() (int, error) {
+	it, err := b.store.Scan(SegmentKey(b.key, keys.Make(EntriesKey, nil)))
+	if err != nil {
+		return 0, err
+	}
+
+	defer it.Close()
+
+	count := 0
+	for it.Next() {
+		count++
+	}
+
+	return count, it.Err()
+}
+
+// Segments returns an iterator over the segments of the set, sorted by their
+// KeySuffix. They can be shipped to another replica and merged into it's set
+// with MergeSegments.
+//
+func (b *BigSetOf[T]) Segments() (SegmentIterator, error) {
+	prefix := segmentKeyPrefix(b.key)
+	it, err := b.store.Scan(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return &storeSegmentIterator{
+		it:        it,
+		prefixLen: len(prefix),
+	}, nil
+}
+
+// Merge another BigSet into this one
+func (b *BigSetOf[T]) Merge(other *BigSetOf[T]) error {
+	segments, err := other.Segments()
+	if err != nil {
+		return err
+	}
+
+	defer segments.Close()
+
+	return b.MergeSegments(segments)
+}
+
+// MergeSegments merges the segments of another set into this one. The segments
+// must be sorted by KeySuffix, as they are by Segments, so that they can be
+// merged with this set's own segments as they are streamed. No segments at all
+// is an empty set.
+//
+// Deferred removals are applied to the elements once the merged set has
+// witnessed their context, until then they're stored as deferred segments.
+//
+// The changes to the elements are written in batches of BigSetBatchSize. The
+// header, and the deferred segments, are written last so that if the merge
+// fails part way this set still hasn't witnessed the other set's version, and
+// merging it again finishes the job.
+//
+func (b *BigSetOf[T]) MergeSegments(segments SegmentIterator) error {
+	if !segments.Next() {
+		// A set that has never been written has no segments at all, it's
+		// empty and has an empty version so there's nothing to merge
+		return segments.Err()
+	}
+
+	header := segments.Segment()
+	if len(header.KeySuffix) != 0 {
+		return fmt.Errorf("Set segments do not start with a header: %s", header.KeySuffix)
+	}
+
+	otherVersion, err := causality.UnmarshalVersionVector(header.Value)
+	if err != nil {
+		return err
+	}
+
+	// Deferred segments sort before the elements, so they've all been read
+	// once the first element has
+	otherDeferred := make([]*Segment, 0)
+	otherEntry, err := nextBigSetEntry(segments, &otherDeferred)
+	if err != nil {
+		return err
+	}
+
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	version, err := b.Version()
+	if err != nil {
+		return err
+	}
+
+	merged := version.Clone()
+	merged.Merge(otherVersion)
+
+	batch := store.CreateBatch()
+	final := store.CreateBatch()
+
+	removals, err := b.mergeDeferred(final, otherDeferred, merged)
+	if err != nil {
+		return err
+	}
+
+	// Only scan our entries, the header has already been read
+	it, err := b.store.Scan(SegmentKey(b.key, keys.Make(EntriesKey, nil)))
+	if err != nil {
+		return err
+	}
+
+	local := &storeSegmentIterator{
+		it:        it,
+		prefixLen: len(segmentKeyPrefix(b.key)),
+	}
+
+	defer local.Close()
+
+	localEntry, err := nextBigSetEntry(local, nil)
+	if err != nil {
+		return err
+	}
+
+	for localEntry != nil || otherEntry != nil {
+		var order int
+		if localEntry == nil {
+			order = 1
+		} else if otherEntry == nil {
+			order = -1
+		} else {
+			order = bytes.Compare(localEntry.KeySuffix, otherEntry.KeySuffix)
+		}
+
+		switch {
+		case order < 0:
+			// Other doesn't have the element. Either it has never seen our dots
+			// or it has seen them and removed the element.
+			keep := localEntry.version.Subtract(otherVersion)
+			keep = applyRemovals(removals, localEntry.KeySuffix, keep)
+			if err := b.putEntry(batch, localEntry, keep); err != nil {
+				return err
+			}
+
+			localEntry, err = nextBigSetEntry(local, nil)
+
+		case order > 0:
+			// We don't have the element, keep the dots that we haven't seen
+			if _, err := b.codec.Decode(otherEntry.KeySuffix[2:]); err != nil {
+				return err
+			}
+
+			uniq := otherEntry.version.Subtract(version)
+			uniq = applyRemovals(removals, otherEntry.KeySuffix, uniq)
+			if !uniq.IsEmpty() {
+				if err := b.putEntry(batch, &bigSetEntry{KeySuffix: otherEntry.KeySuffix}, uniq); err != nil {
+					return err
+				}
+			}
+
+			otherEntry, err = nextBigSetEntry(segments, nil)
+
+		default:
+			// The element is in both but may still have been removed, see
+			// AWSetOf.Merge
+			common := localEntry.version.Intersection(otherEntry.version)
+			lkeep := localEntry.version.Subtract(common).Subtract(otherVersion)
+			rkeep := otherEntry.version.Subtract(common).Subtract(version)
+			common.Merge(lkeep)
+			common.Merge(rkeep)
+			common = applyRemovals(removals, localEntry.KeySuffix, common)
+
+			if err := b.putEntry(batch, localEntry, common); err != nil {
+				return err
+			}
+
+			localEntry, err = nextBigSetEntry(local, nil)
+			if err == nil {
+				otherEntry, err = nextBigSetEntry(segments, nil)
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if batch.Len() >= BigSetBatchSize {
+			if err := b.store.Write(batch); err != nil {
+				return err
+			}
+
+			batch.Reset()
+		}
+	}
+
+	if err := b.store.Write(batch); err != nil {
+		return err
+	}
+
+	v, err := merged.Marshal()
+	if err != nil {
+		return err
+	}
+
+	final.Put(SegmentKey(b.key, nil), v)
+	return b.store.Write(final)
+}
+
+// mergeDeferred merges the deferred segments of another set with this set's.
+// It returns the deferred removals that merged has witnessed the context of,
+// and so can be applied, and adds their deletes to batch. The rest are put in
+// batch if they have changed.
+//
+// This method is not thread safe
+//
+func (b *BigSetOf[T]) mergeDeferred(batch *store.Batch, otherDeferred []*Segment, merged *causality.VersionVector) (DeferredMap, error) {
+	it, err := b.store.Scan(SegmentKey(b.key, keys.Make(DeferredKey, nil)))
+	if err != nil {
+		return nil, err
+	}
+
+	local := &storeSegmentIterator{
+		it:        it,
+		prefixLen: len(segmentKeyPrefix(b.key)),
+	}
+
+	defer local.Close()
+
+	deferred := make(DeferredMap)
+
+	// stored are the key suffixes of the deferreds that are already in the
+	// store, and changed the deferreds that need to be written
+	stored := make(map[*causality.VersionVector][]byte)
+	changed := make(map[*DeferredSet]bool)
+
+	for local.Next() {
+		s := local.Segment()
+		context, deferredSet, err := unmarshalDeferredSegment(s)
+		if err != nil {
+			return nil, err
+		}
+
+		deferred[context] = deferredSet
+		stored[context] = s.KeySuffix
+	}
+
+	if err := local.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, s := range otherDeferred {
+		context, otherSet, err := unmarshalDeferredSegment(s)
+		if err != nil {
+			return nil, err
+		}
+
+		deferredSet := deferred.Find(context)
+		if deferredSet == nil {
+			deferredSet = MakeDeferredSet()
+			deferred[context] = deferredSet
+		}
+
+		for member := range otherSet.Members {
+			if deferredSet.Members[member] {
+				continue
+			}
+
+			if _, err := b.codec.Decode([]byte(member)); err != nil {
+				return nil, err
+			}
+
+			deferredSet.Members[member] = true
+			changed[deferredSet] = true
+		}
+	}
+
+	removals := make(DeferredMap)
+
+	for context, deferredSet := range deferred {
+		keySuffix, exists := stored[context]
+
+		if context.Subtract(merged).IsEmpty() {
+			removals[context] = deferredSet
+			if exists {
+				batch.Delete(SegmentKey(b.key, keySuffix))
+			}
+
+			continue
+		}
+
+		if !changed[deferredSet] {
+			continue
+		}
+
+		if !exists {
+			v, err := context.Marshal()
+			if err != nil {
+				return nil, err
+			}
+
+			keySuffix = keys.Make(DeferredKey, v)
+		}
+
+		d, err := deferredSet.Marshal()
+		if err != nil {
+			return nil, err
+		}
+
+		batch.Put(SegmentKey(b.key, keySuffix), d)
+	}
+
+	return removals, nil
+}
+
+func (b *BigSetOf[T]) entryKey(value T) []byte {
+	return SegmentKey(b.key, keys.Make(EntriesKey, b.codec.Encode(value)))
+}
+
+// putEntry adds the merged version of an entry to batch, if it has changed. An
+// empty version means that the element has been removed.
+//
+func (b *BigSetOf[T]) putEntry(batch *store.Batch, entry *bigSetEntry, version *causality.VersionVector) error {
+	key := SegmentKey(b.key, entry.KeySuffix)
+
+	if version.IsEmpty() {
+		if entry.version != nil {
+			batch.Delete(key)
+		}
+
+		return nil
+	}
+
+	if entry.version != nil && version.Compare(entry.version) == causality.OrderEqual {
+		return nil
+	}
+
+	v, err := version.Marshal()
+	if err != nil {
+		return err
+	}
+
+	batch.Put(key, v)
+	return nil
+}
+
+// bigSetEntry is the segment of an element and it's version
+type bigSetEntry struct {
+	KeySuffix []byte
+	version   *causality.VersionVector
+}
+
+// nextBigSetEntry returns the next element from segments, or nil once there
+// are no more. Any deferred segments before it are appended to deferred, if it
+// isn't nil, otherwise they're unexpected.
+//
+func nextBigSetEntry(segments SegmentIterator, deferred *[]*Segment) (*bigSetEntry, error) {
+	for segments.Next() {
+		s := segments.Segment()
+		if deferred != nil && len(s.KeySuffix) >= 2 && s.KeySuffix[0] == DeferredKey[0] {
+			*deferred = append(*deferred, s)
+			continue
+		}
+
+		if len(s.KeySuffix) < 2 || s.KeySuffix[0] != EntriesKey[0] {
+			return nil, fmt.Errorf("Unexpected key suffix for set: %s", s.KeySuffix)
+		}
+
+		version, err := causality.UnmarshalVersionVector(s.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		return &bigSetEntry{
+			KeySuffix: s.KeySuffix,
+			version:   version,
+		}, nil
+	}
+
+	return nil, segments.Err()
+}
+
+// unmarshalDeferredSegment returns the context and the members of a deferred
+// segment
+//
+func unmarshalDeferredSegment(s *Segment) (*causality.VersionVector, *DeferredSet, error) {
+	// Strip off the key sigil to get the context
+	context, err := causality.UnmarshalVersionVector(s.KeySuffix[2:])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	deferredSet, err := UnmarshalDeferredSet(s.Value)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return context, deferredSet, nil
+}
+
+// applyRemovals removes the dots that the deferred removals of an element
+// have witnessed from it's version
+//
+func applyRemovals(removals DeferredMap, keySuffix []byte, version *causality.VersionVector) *causality.VersionVector {
+	member := string(keySuffix[2:])
+	for context, removed := range removals {
+		if removed.Members[member] {
+			version = version.Subtract(context)
+		}
+	}
+
+	return version
+}
+
+// BigSetIterator iterates over the elements of a BigSet
+type BigSetIterator[T comparable] struct {
+	it        store.Iterator
+	prefixLen int
+	codec     ElementCodec[T]
+	value     T
+	err       error
+}
+
+// Next moves to the next element, it returns false when there are no more
+func (i *BigSetIterator[T]) Next() bool {
+	if i.err != nil || !i.it.Next() {
+		return false
+	}
+
+	value, err := i.codec.Decode(i.it.Key()[i.prefixLen:])
+	if err != nil {
+		i.err = err
+		return false
+	}
+
+	i.value = value
+	return true
+}
+
+// Value returns the current element
+func (i *BigSetIterator[T]) Value() T {
+	return i.value
+}
+
+// Err returns any error that stopped the iteration
+func (i *BigSetIterator[T]) Err() error {
+	if i.err != nil {
+		return i.err
+	}
+
+	return i.it.Err()
+}
+
+// Close releases the iterator
+func (i *BigSetIterator[T]) Close() error {
+	return i.it.Close()
+}
+
+// CreateSegmentIterator returns a SegmentIterator over segments, which don't
+// need to be sorted. This allows the segments of an in-memory value, like an
+// AWSet, to be merged into a BigSet.
+//
+func CreateSegmentIterator(segments []*Segment) SegmentIterator {
+	sorted := make([]*Segment, len(segments))
+	copy(sorted, segments)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i].KeySuffix, sorted[j].KeySuffix) < 0
+	})
+
+	return &sliceSegmentIterator{
+		segments: sorted,
+		i:        -1,
+	}
+}
+
+type sliceSegmentIterator struct {
+	segments []*Segment
+	i        int
+}
+
+func (s *sliceSegmentIterator) Next() bool {
+	if s.i < len(s.segments) {
+		s.i++
+	}
+
+	return s.i < len(s.segments)
+}
+
+func (s *sliceSegmentIterator) Segment() *Segment {
+	return s.segments[s.i]
+}
+
+func (s *sliceSegmentIterator) Err() error {
+	return nil
+}
+
+func (s *sliceSegmentIterator) Close() error {
+	return nil
+}
+
+// storeSegmentIterator is a SegmentIterator over the segments of a value in a
+// Store
+type storeSegmentIterator struct {
+	it        store.Iterator
+	prefixLen int
+}
+
+func (s *storeSegmentIterator) Next() bool {
+	return s.it.Next()
+}
+
+func (s *storeSegmentIterator) Segment() *Segment {
+	return &Segment{
+		KeySuffix: s.it.Key()[s.prefixLen:],
+		Value:     s.it.Value(),
+	}
+}
+
+func (s *storeSegmentIterator) Err() error {
+	return s.it.Err()
+}
+
+func (s *storeSegmentIterator) Close() error {
+	return s.it.Close()
+}
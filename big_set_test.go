@@ -0,0 +1,275 @@
+package rapport_test
+
+import (
+	"sort"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/luma/pith/rapport"
+	"github.com/luma/pith/rapport/store"
+)
+
+var _ = Describe("BigSet", func() {
+	var s *store.MemoryStore
+	var set *BigSet
+
+	values := func(set *BigSet) []string {
+		it, err := set.Values()
+		Expect(err).ToNot(HaveOccurred())
+		defer it.Close()
+
+		values := make([]string, 0)
+		for it.Next() {
+			values = append(values, it.Value())
+		}
+
+		Expect(it.Err()).ToNot(HaveOccurred())
+		return values
+	}
+
+	contains := func(set *BigSet, value string) bool {
+		exists, err := set.Contains(value)
+		Expect(err).ToNot(HaveOccurred())
+		return exists
+	}
+
+	deferred := func(set *BigSet) int {
+		it, err := set.Segments()
+		Expect(err).ToNot(HaveOccurred())
+		defer it.Close()
+
+		count := 0
+		for it.Next() {
+			if keySuffix := it.Segment().KeySuffix; len(keySuffix) > 0 && keySuffix[0] == DeferredKey[0] {
+				count++
+			}
+		}
+
+		Expect(it.Err()).ToNot(HaveOccurred())
+		return count
+	}
+
+	JustBeforeEach(func() {
+		s = store.CreateMemoryStore()
+		set = CreateBigSet(s, []byte("set1"))
+	})
+
+	Describe("AddOne()", func() {
+		It("adds the element", func() {
+			Expect(set.AddOne("foo", "replica1")).To(Succeed())
+
+			Expect(contains(set, "foo")).To(BeTrue())
+			Expect(contains(set, "bar")).To(BeFalse())
+		})
+
+		It("increments the set's version", func() {
+			Expect(set.AddOne("foo", "replica1")).To(Succeed())
+			Expect(set.AddOne("bar", "replica1")).To(Succeed())
+
+			version, err := set.Version()
+			Expect(err).ToNot(HaveOccurred())
+
+			t, _ := version.Get("replica1")
+			Expect(t).To(BeEquivalentTo(2))
+		})
+
+		It("doesn't touch other sets in the same store", func() {
+			other := CreateBigSet(s, []byte("set2"))
+			Expect(set.AddOne("foo", "replica1")).To(Succeed())
+
+			Expect(contains(other, "foo")).To(BeFalse())
+			Expect(values(other)).To(BeEmpty())
+		})
+	})
+
+	Describe("RemoveOne()", func() {
+		It("removes the element", func() {
+			Expect(set.AddOne("foo", "replica1")).To(Succeed())
+
+			removed, err := set.RemoveOne("foo")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(removed).To(BeTrue())
+			Expect(contains(set, "foo")).To(BeFalse())
+
+			removed, err = set.RemoveOne("foo")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(removed).To(BeFalse())
+		})
+	})
+
+	Describe("Values()", func() {
+		It("streams the elements in order", func() {
+			for _, value := range []string{"foo", "bar", "baz"} {
+				Expect(set.AddOne(value, "replica1")).To(Succeed())
+			}
+
+			Expect(values(set)).To(Equal([]string{"bar", "baz", "foo"}))
+			Expect(set.Cardinality()).To(Equal(3))
+		})
+	})
+
+	Describe("Merge()", func() {
+		var set2 *BigSet
+
+		JustBeforeEach(func() {
+			set2 = CreateBigSet(store.CreateMemoryStore(), []byte("set1"))
+		})
+
+		It("adds elements from the other set", func() {
+			Expect(set.AddOne("foo", "replica1")).To(Succeed())
+			Expect(set2.AddOne("bar", "replica2")).To(Succeed())
+
+			Expect(set.Merge(set2)).To(Succeed())
+			Expect(set2.Merge(set)).To(Succeed())
+
+			Expect(values(set)).To(Equal([]string{"bar", "foo"}))
+			Expect(values(set2)).To(Equal([]string{"bar", "foo"}))
+		})
+
+		It("propagates removes", func() {
+			Expect(set.AddOne("foo", "replica1")).To(Succeed())
+			Expect(set.AddOne("bar", "replica1")).To(Succeed())
+			Expect(set2.Merge(set)).To(Succeed())
+
+			_, err := set2.RemoveOne("foo")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(set.Merge(set2)).To(Succeed())
+			Expect(values(set)).To(Equal([]string{"bar"}))
+		})
+
+		It("keeps elements that were added concurrently with a remove", func() {
+			Expect(set.AddOne("foo", "replica1")).To(Succeed())
+			Expect(set2.Merge(set)).To(Succeed())
+
+			_, err := set2.RemoveOne("foo")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(set.AddOne("foo", "replica1")).To(Succeed())
+
+			Expect(set.Merge(set2)).To(Succeed())
+			Expect(set2.Merge(set)).To(Succeed())
+
+			Expect(contains(set, "foo")).To(BeTrue())
+			Expect(contains(set2, "foo")).To(BeTrue())
+		})
+
+		It("does nothing when the other set has never been written", func() {
+			Expect(set.AddOne("foo", "replica1")).To(Succeed())
+
+			Expect(set.Merge(set2)).To(Succeed())
+			Expect(values(set)).To(Equal([]string{"foo"}))
+
+			Expect(set2.Merge(CreateBigSet(store.CreateMemoryStore(), []byte("set1")))).To(Succeed())
+			Expect(values(set2)).To(BeEmpty())
+		})
+
+		It("writes the changes in batches", func() {
+			defer func(size int) { BigSetBatchSize = size }(BigSetBatchSize)
+			BigSetBatchSize = 2
+
+			for _, value := range []string{"a", "b", "c", "d", "e"} {
+				Expect(set2.AddOne(value, "replica2")).To(Succeed())
+			}
+
+			counting := &writeCountingStore{Store: s}
+			set = CreateBigSet(counting, []byte("set1"))
+
+			Expect(set.Merge(set2)).To(Succeed())
+			Expect(values(set)).To(Equal([]string{"a", "b", "c", "d", "e"}))
+			Expect(counting.writes).To(BeNumerically(">=", 3))
+		})
+
+		It("is idempotent", func() {
+			Expect(set.AddOne("foo", "replica1")).To(Succeed())
+			Expect(set2.AddOne("bar", "replica2")).To(Succeed())
+
+			Expect(set.Merge(set2)).To(Succeed())
+			Expect(set.Merge(set2)).To(Succeed())
+
+			Expect(values(set)).To(Equal([]string{"bar", "foo"}))
+		})
+	})
+
+	Describe("MergeSegments()", func() {
+		It("merges the segments of an AWSet", func() {
+			Expect(set.AddOne("foo", "replica1")).To(Succeed())
+
+			awset := CreateAWSet()
+			awset.Add([]string{"bar", "baz"}, "replica2")
+
+			segments, err := awset.Marshal()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(set.MergeSegments(CreateSegmentIterator(segments))).To(Succeed())
+			Expect(values(set)).To(Equal([]string{"bar", "baz", "foo"}))
+		})
+
+		It("can be loaded into an AWSet", func() {
+			Expect(set.AddOne("foo", "replica1")).To(Succeed())
+			Expect(set.AddOne("bar", "replica1")).To(Succeed())
+
+			awset := CreateAWSet()
+			Expect(LoadValue(s, []byte("set1"), awset)).To(Succeed())
+
+			loaded := awset.Values()
+			sort.Strings(loaded)
+			Expect(loaded).To(Equal([]string{"bar", "foo"}))
+		})
+
+		It("applies the removes that an AWSet deferred", func() {
+			Expect(set.AddOne("foo", "replica1")).To(Succeed())
+
+			awset := CreateAWSet()
+			Expect(LoadValue(s, []byte("set1"), awset)).To(Succeed())
+
+			// The AWSet removes an add of foo that it hasn't seen yet
+			Expect(set.AddOne("foo", "replica1")).To(Succeed())
+			version, err := set.Version()
+			Expect(err).ToNot(HaveOccurred())
+			awset.RemoveOneWithContext("foo", version)
+
+			segments, err := awset.Marshal()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(set.MergeSegments(CreateSegmentIterator(segments))).To(Succeed())
+			Expect(contains(set, "foo")).To(BeFalse())
+			Expect(deferred(set)).To(BeZero())
+		})
+
+		It("keeps deferred removes until it has witnessed their context", func() {
+			awset2 := CreateAWSet()
+			awset2.AddOne("foo", "replica2")
+
+			awset := CreateAWSet()
+			awset.RemoveOneWithContext("foo", awset2.Version.Clone())
+
+			segments, err := awset.Marshal()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(set.MergeSegments(CreateSegmentIterator(segments))).To(Succeed())
+			Expect(deferred(set)).To(Equal(1))
+
+			segments, err = awset2.Marshal()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(set.MergeSegments(CreateSegmentIterator(segments))).To(Succeed())
+			Expect(contains(set, "foo")).To(BeFalse())
+			Expect(deferred(set)).To(BeZero())
+		})
+
+		It("requires a header", func() {
+			segments := []*Segment{{KeySuffix: []byte("E:foo")}}
+			Expect(set.MergeSegments(CreateSegmentIterator(segments))).ToNot(Succeed())
+		})
+	})
+})
+
+// writeCountingStore counts the batches that are written to a Store
+type writeCountingStore struct {
+	store.Store
+	writes int
+}
+
+func (s *writeCountingStore) Write(batch *store.Batch) error {
+	s.writes++
+	return s.Store.Write(batch)
+}
@@ -0,0 +1,302 @@
+package rapport
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/luma/pith/keys"
+	"github.com/luma/pith/rapport/marshalling"
+)
+
+var (
+	// RightsKey is the sigil used to deliminate a key that is for the rights
+	// that a bounded counter's replica has transferred
+	RightsKey = []byte("R")
+
+	// ErrInsufficientRights is returned when a replica of a BoundedCounter
+	// doesn't hold enough rights to decrement, or transfer, an amount
+	ErrInsufficientRights = errors.New("Replica does not hold enough rights")
+)
+
+// BoundedCounter is a counter that never goes below a floor. Every increment
+// gives the replica that made it the right to decrement by the same amount. A
+// replica can only decrement using the rights it holds, so that even
+// concurrent decrements can never take the counter below the floor. Replicas
+// can transfer rights to each other to rebalance them.
+//
+// See http://www.gsd.inesc-id.pt/~rodrigo/srds15.pdf
+//
+type BoundedCounter struct {
+	replicaId string
+
+	value *marshalling.BoundedCounterValue
+
+	// transfers are the rights that each replica has transferred to each of
+	// the other replicas
+	transfers map[string]*marshalling.BoundedCounterTransfers
+	l         sync.RWMutex
+}
+
+// CreateBoundedCounter returns a new BoundedCounter, for a specific replica,
+// that starts at, and never goes below, floor.
+//
+func CreateBoundedCounter(replicaId string, floor int64) *BoundedCounter {
+	return &BoundedCounter{
+		replicaId: replicaId,
+		value:     marshalling.CreateBoundedCounter(replicaId, floor),
+		transfers: make(map[string]*marshalling.BoundedCounterTransfers),
+	}
+}
+
+// Incr increments the counter by 1 and returns the new value
+func (b *BoundedCounter) Incr() int64 {
+	return b.IncrBy(1)
+}
+
+// IncrBy increments the counter by amount and returns the new value. The
+// replica gains the right to decrement by amount. Amounts that are not
+// positive are ignored, use DecrBy to decrement.
+//
+func (b *BoundedCounter) IncrBy(amount int64) int64 {
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	if amount > 0 {
+		b.value.Counter.Inc[b.replicaId] += amount
+	}
+
+	return b.value.Value()
+}
+
+// Decr decrements the counter by 1 and returns the new value
+func (b *BoundedCounter) Decr() (int64, error) {
+	return b.DecrBy(1)
+}
+
+// DecrBy decrements the counter by amount and returns the new value. It
+// returns ErrInsufficientRights, and doesn't decrement, if the replica doesn't
+// hold the rights to decrement by amount.
+//
+func (b *BoundedCounter) DecrBy(amount int64) (int64, error) {
+	if amount < 0 {
+		return 0, fmt.Errorf("Cannot decrement by a negative amount: %d", amount)
+	}
+
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	if amount > b.rightsOf(b.replicaId) {
+		return b.value.Value(), ErrInsufficientRights
+	}
+
+	b.value.Counter.Dec[b.replicaId] += amount
+	return b.value.Value(), nil
+}
+
+// TransferRights transfers amount of the replica's rights to another replica.
+// It returns ErrInsufficientRights, and doesn't transfer any, if the replica
+// doesn't hold enough rights.
+//
+func (b *BoundedCounter) TransferRights(to string, amount int64) error {
+	if amount < 0 {
+		return fmt.Errorf("Cannot transfer a negative amount of rights: %d", amount)
+	}
+
+	if to == b.replicaId {
+		return nil
+	}
+
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	if amount > b.rightsOf(b.replicaId) {
+		return ErrInsufficientRights
+	}
+
+	transfers, exists := b.transfers[b.replicaId]
+	if !exists {
+		transfers = marshalling.CreateBoundedCounterTransfers()
+		b.transfers[b.replicaId] = transfers
+	}
+
+	transfers.To[to] += amount
+	return nil
+}
+
+// Rights returns the rights that this replica holds
+func (b *BoundedCounter) Rights() int64 {
+	return b.RightsOf(b.replicaId)
+}
+
+// RightsOf returns the rights that a replica holds, as far as this replica
+// knows.
+//
+func (b *BoundedCounter) RightsOf(replica string) int64 {
+	b.l.RLock()
+	defer b.l.RUnlock()
+
+	return b.rightsOf(replica)
+}
+
+// Value returns the value of the counter
+func (b *BoundedCounter) Value() int64 {
+	b.l.RLock()
+	defer b.l.RUnlock()
+
+	return b.value.Value()
+}
+
+// Floor returns the value that the counter never goes below
+func (b *BoundedCounter) Floor() int64 {
+	b.l.RLock()
+	defer b.l.RUnlock()
+
+	return b.value.Floor
+}
+
+// Merge another BoundedCounter into this one. The increments, decrements, and
+// transfers of rights are merged by taking their maximums.
+//
+// The floor is fixed when a counter is created, so counters with different
+// floors are different counters. Merging one into the other is ignored rather
+// than shifting the value of the counter with the lower floor.
+//
+func (b *BoundedCounter) Merge(crdt CRDT) {
+	other := crdt.(*BoundedCounter)
+
+	b.l.Lock()
+	other.l.RLock()
+
+	defer func() {
+		b.l.Unlock()
+		other.l.RUnlock()
+	}()
+
+	if other.value.Floor != b.value.Floor {
+		return
+	}
+
+	mergePNCounterValues(b.value.Counter, other.value.Counter)
+
+	for from, otherTransfers := range other.transfers {
+		transfers, exists := b.transfers[from]
+		if !exists {
+			transfers = marshalling.CreateBoundedCounterTransfers()
+			b.transfers[from] = transfers
+		}
+
+		for to, amount := range otherTransfers.To {
+			if amount > transfers.To[to] {
+				transfers.To[to] = amount
+			}
+		}
+	}
+}
+
+// Marshal serialises the counter data to bytes. The floor and the counter are
+// in the header segment and the transfers of each replica are in their own
+// segment.
+//
+func (b *BoundedCounter) Marshal() ([]*Segment, error) {
+	b.l.RLock()
+	defer b.l.RUnlock()
+
+	v, err := b.value.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]*Segment, 0, 1+len(b.transfers))
+	segments = append(segments, &Segment{
+		Value: v,
+	})
+
+	for from, transfers := range b.transfers {
+		t, err := transfers.Marshal()
+		if err != nil {
+			return nil, err
+		}
+
+		segments = append(segments, &Segment{
+			KeySuffix: keys.Make(RightsKey, []byte(from)),
+			Value:     t,
+		})
+	}
+
+	return segments, nil
+}
+
+// Unmarshal deserialises the counter data from bytes
+func (b *BoundedCounter) Unmarshal(data []*Segment) error {
+	value := &marshalling.BoundedCounterValue{}
+	if err := value.Unmarshal(data[0].Value); err != nil {
+		return err
+	}
+
+	if value.Counter == nil {
+		value.Counter = marshalling.CreatePNCounter(b.replicaId)
+	}
+
+	if value.Counter.Inc == nil {
+		value.Counter.Inc = make(map[string]int64)
+	}
+
+	if value.Counter.Dec == nil {
+		value.Counter.Dec = make(map[string]int64)
+	}
+
+	transfers := make(map[string]*marshalling.BoundedCounterTransfers)
+	for _, s := range data[1:] {
+		if s.KeySuffix[0] != RightsKey[0] {
+			return fmt.Errorf("Unexpected key suffix for bounded counter: %s", s.KeySuffix)
+		}
+
+		t := marshalling.CreateBoundedCounterTransfers()
+		if err := t.Unmarshal(s.Value); err != nil {
+			return err
+		}
+
+		if t.To == nil {
+			t.To = make(map[string]int64)
+		}
+
+		// Strip off the key sigil to get the replica
+		transfers[string(s.KeySuffix[2:])] = t
+	}
+
+	b.l.Lock()
+	b.value = value
+	b.transfers = transfers
+	b.l.Unlock()
+
+	return nil
+}
+
+func (b *BoundedCounter) bindReplica(replica string) {
+	b.l.Lock()
+	b.replicaId = replica
+	b.l.Unlock()
+}
+
+// rightsOf returns the rights that a replica holds. That's what it has
+// incremented by, plus the rights transferred to it, minus the rights it has
+// transferred away and what it has decremented by.
+//
+// This method is not thread safe
+//
+func (b *BoundedCounter) rightsOf(replica string) int64 {
+	rights := b.value.Counter.Inc[replica] - b.value.Counter.Dec[replica]
+
+	for from, transfers := range b.transfers {
+		if from == replica {
+			for _, amount := range transfers.To {
+				rights -= amount
+			}
+		} else {
+			rights += transfers.To[replica]
+		}
+	}
+
+	return rights
+}
@@ -0,0 +1,178 @@
+package rapport_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/luma/pith/rapport"
+)
+
+var _ = Describe("BoundedCounter", func() {
+	var counter *BoundedCounter
+
+	JustBeforeEach(func() {
+		counter = CreateBoundedCounter("replica1", 10)
+	})
+
+	It("starts at the floor", func() {
+		Expect(counter.Value()).To(Equal(int64(10)))
+		Expect(counter.Floor()).To(Equal(int64(10)))
+		Expect(counter.Rights()).To(Equal(int64(0)))
+	})
+
+	It("is a Counter", func() {
+		var c Counter = counter
+		Expect(c.Incr()).To(Equal(int64(11)))
+	})
+
+	Describe("IncrBy()", func() {
+		It("increments the counter and gives the replica rights", func() {
+			Expect(counter.IncrBy(5)).To(Equal(int64(15)))
+			Expect(counter.Rights()).To(Equal(int64(5)))
+		})
+
+		It("ignores amounts that would decrease the counter", func() {
+			counter.IncrBy(5)
+			Expect(counter.IncrBy(-3)).To(Equal(int64(15)))
+		})
+	})
+
+	Describe("DecrBy()", func() {
+		It("decrements the counter using the replica's rights", func() {
+			counter.IncrBy(5)
+
+			value, err := counter.DecrBy(3)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(Equal(int64(12)))
+			Expect(counter.Rights()).To(Equal(int64(2)))
+		})
+
+		It("never goes below the floor", func() {
+			counter.IncrBy(2)
+
+			value, err := counter.DecrBy(3)
+			Expect(err).To(Equal(ErrInsufficientRights))
+			Expect(value).To(Equal(int64(12)))
+
+			_, err = counter.DecrBy(2)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = counter.Decr()
+			Expect(err).To(Equal(ErrInsufficientRights))
+			Expect(counter.Value()).To(Equal(int64(10)))
+		})
+
+		It("rejects negative amounts", func() {
+			_, err := counter.DecrBy(-1)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("cannot use the rights of another replica", func() {
+			counter2 := CreateBoundedCounter("replica2", 10)
+			counter2.IncrBy(5)
+			counter.Merge(counter2)
+
+			Expect(counter.Value()).To(Equal(int64(15)))
+			_, err := counter.Decr()
+			Expect(err).To(Equal(ErrInsufficientRights))
+		})
+	})
+
+	Describe("TransferRights()", func() {
+		It("moves rights to another replica", func() {
+			counter2 := CreateBoundedCounter("replica2", 10)
+			counter.IncrBy(5)
+
+			Expect(counter.TransferRights("replica2", 3)).To(Succeed())
+			Expect(counter.Rights()).To(Equal(int64(2)))
+			Expect(counter.RightsOf("replica2")).To(Equal(int64(3)))
+			Expect(counter.Value()).To(Equal(int64(15)))
+
+			counter2.Merge(counter)
+			Expect(counter2.Rights()).To(Equal(int64(3)))
+
+			value, err := counter2.DecrBy(3)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(Equal(int64(12)))
+		})
+
+		It("cannot transfer more rights than the replica holds", func() {
+			counter.IncrBy(2)
+
+			Expect(counter.TransferRights("replica2", 3)).To(Equal(ErrInsufficientRights))
+			Expect(counter.Rights()).To(Equal(int64(2)))
+		})
+	})
+
+	Describe("Merge()", func() {
+		It("never goes below the floor under concurrent decrements", func() {
+			counter2 := CreateBoundedCounter("replica2", 10)
+			counter.IncrBy(4)
+			Expect(counter.TransferRights("replica2", 2)).To(Succeed())
+			counter2.Merge(counter)
+
+			_, err := counter.DecrBy(2)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = counter2.DecrBy(2)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = counter.Decr()
+			Expect(err).To(Equal(ErrInsufficientRights))
+			_, err = counter2.Decr()
+			Expect(err).To(Equal(ErrInsufficientRights))
+
+			counter.Merge(counter2)
+			counter2.Merge(counter)
+
+			Expect(counter.Value()).To(Equal(int64(10)))
+			Expect(counter2.Value()).To(Equal(int64(10)))
+		})
+
+		It("is idempotent", func() {
+			counter2 := CreateBoundedCounter("replica2", 10)
+			counter.IncrBy(4)
+			Expect(counter.TransferRights("replica2", 1)).To(Succeed())
+
+			counter2.Merge(counter)
+			counter2.Merge(counter)
+
+			Expect(counter2.Value()).To(Equal(int64(14)))
+			Expect(counter2.Rights()).To(Equal(int64(1)))
+		})
+
+		It("ignores counters with a different floor", func() {
+			counter2 := CreateBoundedCounter("replica2", 3)
+			counter.IncrBy(2)
+			counter2.IncrBy(1)
+
+			counter.Merge(counter2)
+			counter2.Merge(counter)
+
+			Expect(counter.Floor()).To(Equal(int64(10)))
+			Expect(counter2.Floor()).To(Equal(int64(3)))
+			Expect(counter.Value()).To(Equal(int64(12)))
+			Expect(counter2.Value()).To(Equal(int64(4)))
+		})
+	})
+
+	Describe("Marshal()", func() {
+		It("round trips through Unmarshal()", func() {
+			counter.IncrBy(6)
+			Expect(counter.TransferRights("replica2", 2)).To(Succeed())
+			_, err := counter.DecrBy(1)
+			Expect(err).ToNot(HaveOccurred())
+
+			segments, err := counter.Marshal()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(segments).To(HaveLen(2))
+
+			counter2 := CreateBoundedCounter("replica1", 0)
+			Expect(counter2.Unmarshal(segments)).To(Succeed())
+
+			Expect(counter2.Value()).To(Equal(int64(15)))
+			Expect(counter2.Floor()).To(Equal(int64(10)))
+			Expect(counter2.Rights()).To(Equal(int64(3)))
+			Expect(counter2.RightsOf("replica2")).To(Equal(int64(2)))
+		})
+	})
+})
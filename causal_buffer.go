@@ -0,0 +1,190 @@
+package rapport
+
+import (
+	"sync"
+
+	"github.com/luma/pith/rapport/causality"
+	"github.com/luma/pith/rapport/marshalling"
+)
+
+// CausalBuffer delivers operations to an OperationApplier exactly once and in
+// causal order. Each replica has its own buffer for each Value.
+//
+// Local operations are stamped with the buffer's VersionVector before they are
+// sent to other replicas. Operations from other replicas are held until every
+// operation that they depend on has been delivered, and operations that have
+// already been delivered are dropped.
+//
+type CausalBuffer struct {
+	replica string
+	target  OperationApplier
+
+	// version is the VersionVector of every operation that has been
+	// delivered
+	version *causality.VersionVector
+	pending []*bufferedOperation
+	l       sync.Mutex
+}
+
+type bufferedOperation struct {
+	op      *marshalling.Operation
+	version *causality.VersionVector
+}
+
+// CreateCausalBuffer returns a new, empty, CausalBuffer that delivers
+// operations to target for replica.
+//
+func CreateCausalBuffer(replica string, target OperationApplier) *CausalBuffer {
+	return &CausalBuffer{
+		replica: replica,
+		target:  target,
+		version: causality.CreateVersionVector(),
+		pending: make([]*bufferedOperation, 0),
+	}
+}
+
+// Stamp records a local operation, one that has already been applied to the
+// target, as delivered and sets its version so that it can be sent to other
+// replicas.
+//
+func (b *CausalBuffer) Stamp(op *marshalling.Operation) error {
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	b.version.Incr(b.replica)
+
+	version, err := b.version.Marshal()
+	if err != nil {
+		return err
+	}
+
+	op.Replica = b.replica
+	op.Version = version
+	return nil
+}
+
+// Deliver receives an operation from another replica. The operation, and any
+// held operations that were waiting on it, are applied to the target. It
+// returns the number of operations that were applied.
+//
+// If an operation fails to apply it's skipped, so that operations that depend
+// on it aren't held forever, and the error is returned.
+//
+func (b *CausalBuffer) Deliver(op *marshalling.Operation) (int, error) {
+	version, err := causality.UnmarshalVersionVector(op.Version)
+	if err != nil {
+		return 0, err
+	}
+
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	if b.isDelivered(op.Replica, version) || b.isPending(op.Replica, version) {
+		return 0, nil
+	}
+
+	b.pending = append(b.pending, &bufferedOperation{op: op, version: version})
+
+	applied := 0
+	var applyErr error
+
+	for {
+		i := b.nextDeliverable()
+		if i < 0 {
+			return applied, applyErr
+		}
+
+		next := b.pending[i]
+		b.pending = append(b.pending[:i], b.pending[i+1:]...)
+
+		if err := b.target.ApplyOperation(next.op); err != nil && applyErr == nil {
+			applyErr = err
+		} else if err == nil {
+			applied++
+		}
+
+		t, _ := next.version.Get(next.op.Replica)
+		b.version.Witness(next.op.Replica, t)
+	}
+}
+
+// Version returns a copy of the VersionVector of every operation that has
+// been delivered.
+//
+func (b *CausalBuffer) Version() *causality.VersionVector {
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	return b.version.Clone()
+}
+
+// Pending returns the number of operations that are waiting for operations
+// that they depend on.
+//
+func (b *CausalBuffer) Pending() int {
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	return len(b.pending)
+}
+
+// isDelivered indicates whether the operation from replica with version has
+// been delivered already
+//
+// This method is not thread safe
+//
+func (b *CausalBuffer) isDelivered(replica string, version *causality.VersionVector) bool {
+	t, _ := version.Get(replica)
+	delivered, _ := b.version.Get(replica)
+	return t <= delivered
+}
+
+// isPending indicates whether the operation from replica with version is
+// already being held
+//
+// This method is not thread safe
+//
+func (b *CausalBuffer) isPending(replica string, version *causality.VersionVector) bool {
+	t, _ := version.Get(replica)
+
+	for _, pending := range b.pending {
+		if pending.op.Replica != replica {
+			continue
+		}
+
+		if pendingTime, _ := pending.version.Get(replica); pendingTime == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// nextDeliverable returns the index of a pending operation whose dependencies
+// have all been delivered, or -1 if there are none. That's an operation that
+// is the next one from its replica and that has only seen operations from
+// other replicas that we have seen too.
+//
+// This method is not thread safe
+//
+func (b *CausalBuffer) nextDeliverable() int {
+	for i, pending := range b.pending {
+		deliverable := true
+
+		pending.version.REach(func(actor string, t causality.LamportTime) {
+			delivered, _ := b.version.Get(actor)
+
+			if actor == pending.op.Replica {
+				deliverable = deliverable && t == delivered+1
+			} else {
+				deliverable = deliverable && t <= delivered
+			}
+		})
+
+		if deliverable {
+			return i
+		}
+	}
+
+	return -1
+}
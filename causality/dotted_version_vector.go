@@ -0,0 +1,233 @@
+package causality
+
+import (
+	"sort"
+	"sync"
+)
+
+// DottedVersionVector is a causal context that can represent gaps. It's made
+// from a contiguous base VersionVector, which has witnessed every event from 1
+// up to it's time for each actor, and a set of events (dots) that have been
+// witnessed out of order.
+//
+// Think ( {"ReplicaA", 2}, {"ReplicaB", 1} ) + [ {"ReplicaA", 4} ]
+//
+// See https://github.com/ricardobcl/Dotted-Version-Vectors
+//
+type DottedVersionVector struct {
+	base *VersionVector
+	dots map[Event]bool
+	l    sync.RWMutex
+}
+
+// CreateDottedVersionVector returns a new, empty DottedVersionVector
+func CreateDottedVersionVector() *DottedVersionVector {
+	return &DottedVersionVector{
+		base: CreateVersionVector(),
+		dots: make(map[Event]bool),
+	}
+}
+
+// UnmarshalDottedVersionVector is a helper method to create a new dotted
+// version vector and umarshal binary data into it
+func UnmarshalDottedVersionVector(data []byte) (*DottedVersionVector, error) {
+	version := CreateDottedVersionVector()
+	if err := version.Unmarshal(data); err != nil {
+		return nil, err
+	}
+
+	return version, nil
+}
+
+// Add witnesses a single event. If the event is contiguous with the base then
+// the base is advanced, otherwise it's kept as a dot until the gap is filled.
+//
+func (d *DottedVersionVector) Add(e Event) {
+	d.l.Lock()
+	d.dots[e] = true
+	d.compact()
+	d.l.Unlock()
+}
+
+// Next returns the next event for actor, i.e. the event immediately after
+// the newest contiguous event that has been witnessed for it. The event is
+// witnessed before being returned.
+//
+func (d *DottedVersionVector) Next(actor string) Event {
+	d.l.Lock()
+	defer d.l.Unlock()
+
+	t, _ := d.base.Get(actor)
+	e := Event{Actor: actor, Time: t + 1}
+
+	d.dots[e] = true
+	d.compact()
+
+	return e
+}
+
+// Contains indicates whether the event has been witnessed, either by the base
+// or as a dot.
+//
+func (d *DottedVersionVector) Contains(e Event) bool {
+	d.l.RLock()
+	defer d.l.RUnlock()
+
+	return d.base.Includes(e) || d.dots[e]
+}
+
+// Join merges another DottedVersionVector into this one. The result has
+// witnessed every event that either has witnessed.
+//
+func (d *DottedVersionVector) Join(other *DottedVersionVector) {
+	other.l.RLock()
+	base := other.base.Clone()
+	dots := make([]Event, 0, len(other.dots))
+	for e := range other.dots {
+		dots = append(dots, e)
+	}
+	other.l.RUnlock()
+
+	d.l.Lock()
+	d.base.Merge(base)
+	for _, e := range dots {
+		d.dots[e] = true
+	}
+	d.compact()
+	d.l.Unlock()
+}
+
+// Compact folds any dots that are contiguous with the base into the base, and
+// discards dots that the base has already witnessed.
+//
+func (d *DottedVersionVector) Compact() {
+	d.l.Lock()
+	d.compact()
+	d.l.Unlock()
+}
+
+// Base returns a copy of the contiguous base VersionVector
+func (d *DottedVersionVector) Base() *VersionVector {
+	d.l.RLock()
+	defer d.l.RUnlock()
+
+	return d.base.Clone()
+}
+
+// Dots returns the events that have been witnessed out of order, sorted by
+// actor and then time
+func (d *DottedVersionVector) Dots() []Event {
+	d.l.RLock()
+	dots := make([]Event, 0, len(d.dots))
+	for e := range d.dots {
+		dots = append(dots, e)
+	}
+	d.l.RUnlock()
+
+	sort.Slice(dots, func(i, j int) bool {
+		if dots[i].Actor == dots[j].Actor {
+			return dots[i].Time < dots[j].Time
+		}
+
+		return dots[i].Actor < dots[j].Actor
+	})
+
+	return dots
+}
+
+// IsEmpty returns true if no events have been witnessed
+func (d *DottedVersionVector) IsEmpty() bool {
+	d.l.RLock()
+	defer d.l.RUnlock()
+
+	return d.base.IsEmpty() && len(d.dots) == 0
+}
+
+// Clone is a deep-copy of the DottedVersionVector
+func (d *DottedVersionVector) Clone() *DottedVersionVector {
+	d.l.RLock()
+	defer d.l.RUnlock()
+
+	dots := make(map[Event]bool, len(d.dots))
+	for e := range d.dots {
+		dots[e] = true
+	}
+
+	return &DottedVersionVector{
+		base: d.base.Clone(),
+		dots: dots,
+	}
+}
+
+// Marshal serialises this DottedVersionVector to binary using protocol
+// buffers
+func (d *DottedVersionVector) Marshal() (data []byte, err error) {
+	value := &DottedVersionVectorValue{
+		Base: CreateVersionVectorValue(),
+	}
+
+	d.l.RLock()
+	d.base.REach(func(actor string, t LamportTime) {
+		value.Base.Dots[actor] = &Dot{Time: t}
+	})
+
+	value.Dots = make([]*EventValue, 0, len(d.dots))
+	for e := range d.dots {
+		value.Dots = append(value.Dots, &EventValue{
+			Actor: e.Actor,
+			Time:  e.Time,
+		})
+	}
+	d.l.RUnlock()
+
+	return value.Marshal()
+}
+
+// Unmarshal parses a protobuf encoded DottedVersionVector and loads
+// it's data into d.
+func (d *DottedVersionVector) Unmarshal(data []byte) error {
+	value := &DottedVersionVectorValue{}
+
+	if err := value.Unmarshal(data); err != nil {
+		return err
+	}
+
+	d.l.Lock()
+	defer d.l.Unlock()
+
+	if value.Base != nil {
+		for actor, dot := range value.Base.Dots {
+			d.base.Witness(actor, dot.Time)
+		}
+	}
+
+	for _, e := range value.Dots {
+		d.dots[Event{Actor: e.Actor, Time: e.Time}] = true
+	}
+
+	d.compact()
+	return nil
+}
+
+// compact folds contiguous dots into the base
+//
+// This method is not thread safe
+//
+func (d *DottedVersionVector) compact() {
+	for changed := true; changed; {
+		changed = false
+
+		for e := range d.dots {
+			t, _ := d.base.Get(e.Actor)
+
+			if e.Time == t+1 {
+				d.base.Witness(e.Actor, e.Time)
+				changed = true
+			}
+
+			if e.Time <= t+1 {
+				delete(d.dots, e)
+			}
+		}
+	}
+}
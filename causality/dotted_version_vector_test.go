@@ -0,0 +1,142 @@
+package causality_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/luma/pith/rapport/causality"
+)
+
+var _ = Describe("DottedVersionVector", func() {
+	var dvv *DottedVersionVector
+
+	event := func(actor string, t int) Event {
+		return Event{Actor: actor, Time: LamportTime(t)}
+	}
+
+	BeforeEach(func() {
+		dvv = CreateDottedVersionVector()
+	})
+
+	It("can create a new empty DottedVersionVector with CreateDottedVersionVector()", func() {
+		Expect(dvv.IsEmpty()).To(BeTrue())
+	})
+
+	Describe("Add()", func() {
+		It("advances the base for contiguous events", func() {
+			dvv.Add(event("a", 1))
+			dvv.Add(event("a", 2))
+
+			t, _ := dvv.Base().Get("a")
+			Expect(t).To(Equal(LamportTime(2)))
+			Expect(dvv.Dots()).To(BeEmpty())
+		})
+
+		It("keeps events with gaps as dots", func() {
+			dvv.Add(event("a", 1))
+			dvv.Add(event("a", 3))
+
+			t, _ := dvv.Base().Get("a")
+			Expect(t).To(Equal(LamportTime(1)))
+			Expect(dvv.Dots()).To(Equal([]Event{event("a", 3)}))
+		})
+
+		It("folds dots into the base once the gap is filled", func() {
+			dvv.Add(event("a", 3))
+			dvv.Add(event("a", 2))
+			dvv.Add(event("a", 1))
+
+			t, _ := dvv.Base().Get("a")
+			Expect(t).To(Equal(LamportTime(3)))
+			Expect(dvv.Dots()).To(BeEmpty())
+		})
+	})
+
+	Describe("Next()", func() {
+		It("returns the event after the contiguous base", func() {
+			dvv.Add(event("a", 1))
+			Expect(dvv.Next("a")).To(Equal(event("a", 2)))
+			Expect(dvv.Next("b")).To(Equal(event("b", 1)))
+			Expect(dvv.Contains(event("a", 2))).To(BeTrue())
+		})
+	})
+
+	Describe("Contains()", func() {
+		BeforeEach(func() {
+			dvv.Add(event("a", 1))
+			dvv.Add(event("a", 2))
+			dvv.Add(event("a", 5))
+		})
+
+		It("returns true for events in the base", func() {
+			Expect(dvv.Contains(event("a", 1))).To(BeTrue())
+			Expect(dvv.Contains(event("a", 2))).To(BeTrue())
+		})
+
+		It("returns true for dots", func() {
+			Expect(dvv.Contains(event("a", 5))).To(BeTrue())
+		})
+
+		It("returns false for events in the gaps", func() {
+			Expect(dvv.Contains(event("a", 3))).To(BeFalse())
+			Expect(dvv.Contains(event("a", 4))).To(BeFalse())
+			Expect(dvv.Contains(event("b", 1))).To(BeFalse())
+		})
+	})
+
+	Describe("Join()", func() {
+		It("contains the events of both", func() {
+			dvv.Add(event("a", 1))
+			dvv.Add(event("b", 3))
+
+			other := CreateDottedVersionVector()
+			other.Add(event("a", 2))
+			other.Add(event("a", 3))
+			other.Add(event("b", 1))
+
+			dvv.Join(other)
+
+			t, _ := dvv.Base().Get("a")
+			Expect(t).To(Equal(LamportTime(3)))
+			t, _ = dvv.Base().Get("b")
+			Expect(t).To(Equal(LamportTime(1)))
+			Expect(dvv.Dots()).To(Equal([]Event{event("b", 3)}))
+		})
+	})
+
+	Describe("Compact()", func() {
+		It("discards dots that the base has witnessed", func() {
+			dvv.Add(event("a", 3))
+
+			base := CreateDottedVersionVector()
+			base.Add(event("a", 1))
+			base.Add(event("a", 2))
+			base.Add(event("a", 3))
+			base.Add(event("a", 4))
+			dvv.Join(base)
+			dvv.Compact()
+
+			Expect(dvv.Dots()).To(BeEmpty())
+		})
+	})
+
+	Describe("Marshal()", func() {
+		It("round trips through Unmarshal()", func() {
+			dvv.Add(event("a", 1))
+			dvv.Add(event("a", 3))
+			dvv.Add(event("b", 2))
+
+			data, err := dvv.Marshal()
+			Expect(err).ToNot(HaveOccurred())
+
+			dvv2, err := UnmarshalDottedVersionVector(data)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(dvv2.Contains(event("a", 1))).To(BeTrue())
+			Expect(dvv2.Contains(event("a", 2))).To(BeFalse())
+			Expect(dvv2.Contains(event("a", 3))).To(BeTrue())
+			Expect(dvv2.Contains(event("b", 2))).To(BeTrue())
+			Expect(dvv2.Dots()).To(Equal(dvv.Dots()))
+		})
+	})
+})
@@ -0,0 +1,18 @@
+package causality
+
+import "fmt"
+
+// Event identifies a single event by the actor that generated it and the
+// LamportTime that it was generated at. This is often called a dot.
+//
+// Think {"ReplicaA", 2}
+//
+type Event struct {
+	Actor string
+	Time  LamportTime
+}
+
+// String returns a human readable version of the Event
+func (e Event) String() string {
+	return fmt.Sprintf("%s:%d", e.Actor, e.Time)
+}
@@ -0,0 +1,166 @@
+package causality
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// PhysicalClock is a source of physical time, in nanoseconds since the Unix
+// epoch. It can be swapped out in tests to simulate clock skew.
+type PhysicalClock func() int64
+
+// WallClock is the PhysicalClock backed by the system clock
+func WallClock() int64 {
+	return time.Now().UnixNano()
+}
+
+// HLCTimestamp is a timestamp from a Hybrid Logical Clock. It combines the
+// physical time with a logical counter that orders events which happen within
+// the same physical time.
+//
+type HLCTimestamp struct {
+	WallTime int64
+	Logical  uint32
+}
+
+// UnmarshalHLCTimestamp parses a protobuf encoded HLCTimestamp
+func UnmarshalHLCTimestamp(data []byte) (HLCTimestamp, error) {
+	value := &HLCTimestampValue{}
+	if err := value.Unmarshal(data); err != nil {
+		return HLCTimestamp{}, err
+	}
+
+	return HLCTimestamp{
+		WallTime: value.WallTime,
+		Logical:  value.Logical,
+	}, nil
+}
+
+// Compare returns the order between this and another timestamp. Unlike vector
+// clocks HLC timestamps are totally ordered, so it never returns OrderNone.
+//
+func (t HLCTimestamp) Compare(other HLCTimestamp) CausalOrder {
+	switch {
+	case t.WallTime < other.WallTime:
+		return OrderLess
+	case t.WallTime > other.WallTime:
+		return OrderGreater
+	case t.Logical < other.Logical:
+		return OrderLess
+	case t.Logical > other.Logical:
+		return OrderGreater
+	default:
+		return OrderEqual
+	}
+}
+
+// Before indicates whether this timestamp is older than the other
+func (t HLCTimestamp) Before(other HLCTimestamp) bool {
+	return t.Compare(other) == OrderLess
+}
+
+// IsZero indicates whether this is the zero timestamp
+func (t HLCTimestamp) IsZero() bool {
+	return t.WallTime == 0 && t.Logical == 0
+}
+
+// String returns a human readable version of the timestamp
+func (t HLCTimestamp) String() string {
+	return fmt.Sprintf("%d.%d", t.WallTime, t.Logical)
+}
+
+// Marshal serialises this HLCTimestamp to binary using protocol buffers
+func (t HLCTimestamp) Marshal() (data []byte, err error) {
+	value := &HLCTimestampValue{
+		WallTime: t.WallTime,
+		Logical:  t.Logical,
+	}
+
+	return value.Marshal()
+}
+
+// HLC is a Hybrid Logical Clock. It produces timestamps that are close to
+// physical time, but that still respect causality when nodes clocks are
+// skewed: a timestamp is always greater than any timestamp the clock has
+// generated or observed before it.
+//
+// See https://cse.buffalo.edu/tech-reports/2014-04.pdf
+//
+type HLC struct {
+	clock PhysicalClock
+	last  HLCTimestamp
+	l     sync.Mutex
+}
+
+// CreateHLC returns a new HLC that reads physical time from clock. If clock is
+// nil then the WallClock is used.
+//
+func CreateHLC(clock PhysicalClock) *HLC {
+	if clock == nil {
+		clock = WallClock
+	}
+
+	return &HLC{clock: clock}
+}
+
+// Now returns a timestamp for a local event
+func (h *HLC) Now() HLCTimestamp {
+	h.l.Lock()
+	defer h.l.Unlock()
+
+	pt := h.clock()
+
+	if pt > h.last.WallTime {
+		h.last = HLCTimestamp{WallTime: pt}
+	} else {
+		h.last.Logical++
+	}
+
+	return h.last
+}
+
+// Update witnesses a timestamp from another node and returns a timestamp for
+// the receive event, which is greater than both remote and any timestamp this
+// clock has produced before.
+//
+func (h *HLC) Update(remote HLCTimestamp) HLCTimestamp {
+	h.l.Lock()
+	defer h.l.Unlock()
+
+	pt := h.clock()
+	last := h.last
+
+	wallTime := pt
+	if last.WallTime > wallTime {
+		wallTime = last.WallTime
+	}
+	if remote.WallTime > wallTime {
+		wallTime = remote.WallTime
+	}
+
+	var logical uint32
+	switch {
+	case wallTime == last.WallTime && wallTime == remote.WallTime:
+		logical = last.Logical
+		if remote.Logical > logical {
+			logical = remote.Logical
+		}
+		logical++
+	case wallTime == last.WallTime:
+		logical = last.Logical + 1
+	case wallTime == remote.WallTime:
+		logical = remote.Logical + 1
+	}
+
+	h.last = HLCTimestamp{WallTime: wallTime, Logical: logical}
+	return h.last
+}
+
+// Last returns the newest timestamp the clock has produced
+func (h *HLC) Last() HLCTimestamp {
+	h.l.Lock()
+	defer h.l.Unlock()
+
+	return h.last
+}
@@ -0,0 +1,93 @@
+package causality_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/luma/pith/rapport/causality"
+)
+
+var _ = Describe("HLC", func() {
+	var now int64
+	var clock *HLC
+
+	BeforeEach(func() {
+		now = 100
+		clock = CreateHLC(func() int64 { return now })
+	})
+
+	Describe("Now()", func() {
+		It("uses the physical time when it has moved forward", func() {
+			Expect(clock.Now()).To(Equal(HLCTimestamp{WallTime: 100}))
+
+			now = 200
+			Expect(clock.Now()).To(Equal(HLCTimestamp{WallTime: 200}))
+		})
+
+		It("increments the logical counter when the physical time has not moved", func() {
+			clock.Now()
+			Expect(clock.Now()).To(Equal(HLCTimestamp{WallTime: 100, Logical: 1}))
+		})
+
+		It("never goes backwards when the physical time does", func() {
+			clock.Now()
+			now = 50
+			Expect(clock.Now()).To(Equal(HLCTimestamp{WallTime: 100, Logical: 1}))
+		})
+	})
+
+	Describe("Update()", func() {
+		It("moves past remote timestamps that are ahead", func() {
+			clock.Now()
+			ts := clock.Update(HLCTimestamp{WallTime: 500, Logical: 3})
+			Expect(ts).To(Equal(HLCTimestamp{WallTime: 500, Logical: 4}))
+
+			Expect(clock.Now()).To(Equal(HLCTimestamp{WallTime: 500, Logical: 5}))
+		})
+
+		It("moves past the last timestamp when the remote is behind", func() {
+			clock.Now()
+			ts := clock.Update(HLCTimestamp{WallTime: 50, Logical: 3})
+			Expect(ts).To(Equal(HLCTimestamp{WallTime: 100, Logical: 1}))
+		})
+
+		It("takes the largest logical counter when the wall times are equal", func() {
+			clock.Now()
+			ts := clock.Update(HLCTimestamp{WallTime: 100, Logical: 7})
+			Expect(ts).To(Equal(HLCTimestamp{WallTime: 100, Logical: 8}))
+		})
+
+		It("uses the physical time when it is ahead of both", func() {
+			clock.Now()
+			now = 1000
+			ts := clock.Update(HLCTimestamp{WallTime: 500, Logical: 7})
+			Expect(ts).To(Equal(HLCTimestamp{WallTime: 1000}))
+		})
+	})
+
+	Describe("Compare()", func() {
+		It("orders by wall time and then by logical counter", func() {
+			a := HLCTimestamp{WallTime: 100, Logical: 2}
+			b := HLCTimestamp{WallTime: 100, Logical: 3}
+			c := HLCTimestamp{WallTime: 101}
+
+			Expect(a.Compare(b)).To(Equal(OrderLess))
+			Expect(b.Compare(a)).To(Equal(OrderGreater))
+			Expect(b.Compare(c)).To(Equal(OrderLess))
+			Expect(a.Compare(a)).To(Equal(OrderEqual))
+			Expect(a.Before(c)).To(BeTrue())
+		})
+	})
+
+	Describe("Marshal()", func() {
+		It("round trips through UnmarshalHLCTimestamp()", func() {
+			ts := HLCTimestamp{WallTime: 1234, Logical: 5}
+			data, err := ts.Marshal()
+			Expect(err).ToNot(HaveOccurred())
+
+			ts2, err := UnmarshalHLCTimestamp(data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ts2).To(Equal(ts))
+		})
+	})
+})
@@ -0,0 +1,470 @@
+package causality
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ITC is a stamp from an Interval Tree Clock. Unlike a VersionVector, which
+// needs an entry for every replica that has ever existed, an ITC stamp is made
+// from an id tree, the portion of the id space that a replica owns, and an
+// event tree that records the events seen for every portion of the id space.
+// Replicas can be created by forking a stamp and retired by joining it back,
+// so the stamps stay small even when replicas come and go.
+//
+// Stamps are immutable, every operation returns a new stamp.
+//
+// See http://gsd.di.uminho.pt/members/cbm/ps/itc2008.pdf
+//
+type ITC struct {
+	id    *itcID
+	event *itcEvent
+}
+
+// itcID is a node of an ITC id tree. Leaves are either 0 or 1.
+type itcID struct {
+	leaf        bool
+	value       uint8
+	left, right *itcID
+}
+
+// itcEvent is a node of an ITC event tree. Leaves have no children.
+type itcEvent struct {
+	n           uint64
+	left, right *itcEvent
+}
+
+var (
+	itcIDZero = &itcID{leaf: true, value: 0}
+	itcIDOne  = &itcID{leaf: true, value: 1}
+
+	// errMalformedITC is returned when unmarshalling data that isn't an ITC
+	errMalformedITC = errors.New("Malformed Interval Tree Clock data")
+)
+
+// itcGrowCost is the cost of expanding an event tree leaf when growing, it
+// has to be larger than the height of any tree so that it's only done as a
+// last resort.
+const itcGrowCost = 1 << 20
+
+// SeedITC returns the seed stamp, it owns the whole id space and has seen no
+// events. It's the stamp that the first replica starts from.
+//
+func SeedITC() *ITC {
+	return &ITC{
+		id:    itcIDOne,
+		event: &itcEvent{},
+	}
+}
+
+// UnmarshalITC parses a binary encoded ITC stamp
+func UnmarshalITC(data []byte) (*ITC, error) {
+	id, data, err := unmarshalITCID(data)
+	if err != nil {
+		return nil, err
+	}
+
+	event, data, err := unmarshalITCEvent(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) != 0 {
+		return nil, errMalformedITC
+	}
+
+	return &ITC{id: id, event: event}, nil
+}
+
+// Fork splits the stamp's id in two, returning two stamps with the same events
+// but disjoint ids. It's how new replicas are created.
+//
+func (s *ITC) Fork() (*ITC, *ITC) {
+	id1, id2 := splitITCID(s.id)
+	return &ITC{id: id1, event: s.event}, &ITC{id: id2, event: s.event}
+}
+
+// Peek returns an anonymous stamp, it has the same events but owns no part of
+// the id space. It can be used to send causal information without giving away
+// the ability to record events.
+//
+func (s *ITC) Peek() *ITC {
+	return &ITC{id: itcIDZero, event: s.event}
+}
+
+// Event returns a stamp that has recorded a new event for this stamp's id.
+// Anonymous stamps can't record events so they are returned unchanged.
+//
+func (s *ITC) Event() *ITC {
+	if s.IsAnonymous() {
+		return s
+	}
+
+	event := fillITC(s.id, s.event)
+	if !equalITCEvents(event, s.event) {
+		return &ITC{id: s.id, event: event}
+	}
+
+	event, _ = growITC(s.id, s.event)
+	return &ITC{id: s.id, event: event}
+}
+
+// Join merges another stamp into this one. The resulting stamp owns both ids
+// and has seen the events of both. It's how replicas are retired.
+//
+func (s *ITC) Join(other *ITC) *ITC {
+	return &ITC{
+		id:    sumITCIDs(s.id, other.id),
+		event: joinITCEvents(s.event, other.event),
+	}
+}
+
+// Leq indicates whether every event this stamp has seen has also been seen by
+// the other stamp.
+//
+func (s *ITC) Leq(other *ITC) bool {
+	return leqITCEvents(s.event, other.event)
+}
+
+// Compare returns the causal order between this and another stamp
+//
+func (s *ITC) Compare(other *ITC) CausalOrder {
+	leq := s.Leq(other)
+	geq := other.Leq(s)
+
+	switch {
+	case leq && geq:
+		return OrderEqual
+	case leq:
+		return OrderLess
+	case geq:
+		return OrderGreater
+	default:
+		return OrderNone
+	}
+}
+
+// IsAnonymous indicates whether the stamp owns no part of the id space
+func (s *ITC) IsAnonymous() bool {
+	return s.id.leaf && s.id.value == 0
+}
+
+// Marshal serialises the stamp to a compact binary encoding
+func (s *ITC) Marshal() (data []byte, err error) {
+	data = marshalITCID(s.id, make([]byte, 0, 16))
+	return marshalITCEvent(s.event, data), nil
+}
+
+func newITCIDNode(left, right *itcID) *itcID {
+	if left.leaf && right.leaf && left.value == right.value {
+		return left
+	}
+
+	return &itcID{left: left, right: right}
+}
+
+func splitITCID(i *itcID) (*itcID, *itcID) {
+	if i.leaf {
+		if i.value == 0 {
+			return itcIDZero, itcIDZero
+		}
+
+		return &itcID{left: itcIDOne, right: itcIDZero}, &itcID{left: itcIDZero, right: itcIDOne}
+	}
+
+	if isITCIDZero(i.left) {
+		i1, i2 := splitITCID(i.right)
+		return &itcID{left: itcIDZero, right: i1}, &itcID{left: itcIDZero, right: i2}
+	}
+
+	if isITCIDZero(i.right) {
+		i1, i2 := splitITCID(i.left)
+		return &itcID{left: i1, right: itcIDZero}, &itcID{left: i2, right: itcIDZero}
+	}
+
+	return &itcID{left: i.left, right: itcIDZero}, &itcID{left: itcIDZero, right: i.right}
+}
+
+func sumITCIDs(i1, i2 *itcID) *itcID {
+	if isITCIDZero(i1) {
+		return i2
+	}
+
+	if isITCIDZero(i2) {
+		return i1
+	}
+
+	if i1.leaf || i2.leaf {
+		// Both own some of the same part of the id space, which only
+		// happens if the stamps weren't forked from each other.
+		return itcIDOne
+	}
+
+	return newITCIDNode(sumITCIDs(i1.left, i2.left), sumITCIDs(i1.right, i2.right))
+}
+
+func isITCIDZero(i *itcID) bool {
+	return i.leaf && i.value == 0
+}
+
+func isITCIDOne(i *itcID) bool {
+	return i.leaf && i.value == 1
+}
+
+func newITCEventNode(n uint64, left, right *itcEvent) *itcEvent {
+	if left.left == nil && right.left == nil && left.n == right.n {
+		return &itcEvent{n: n + left.n}
+	}
+
+	m := minITCEvent(left)
+	if mr := minITCEvent(right); mr < m {
+		m = mr
+	}
+
+	return &itcEvent{
+		n:     n + m,
+		left:  sinkITCEvent(left, m),
+		right: sinkITCEvent(right, m),
+	}
+}
+
+func liftITCEvent(e *itcEvent, m uint64) *itcEvent {
+	return &itcEvent{n: e.n + m, left: e.left, right: e.right}
+}
+
+func sinkITCEvent(e *itcEvent, m uint64) *itcEvent {
+	return &itcEvent{n: e.n - m, left: e.left, right: e.right}
+}
+
+func minITCEvent(e *itcEvent) uint64 {
+	if e.left == nil {
+		return e.n
+	}
+
+	m := minITCEvent(e.left)
+	if mr := minITCEvent(e.right); mr < m {
+		m = mr
+	}
+
+	return e.n + m
+}
+
+func maxITCEvent(e *itcEvent) uint64 {
+	if e.left == nil {
+		return e.n
+	}
+
+	m := maxITCEvent(e.left)
+	if mr := maxITCEvent(e.right); mr > m {
+		m = mr
+	}
+
+	return e.n + m
+}
+
+func leqITCEvents(e1, e2 *itcEvent) bool {
+	if e1.n > e2.n {
+		return false
+	}
+
+	if e1.left == nil {
+		return true
+	}
+
+	if e2.left == nil {
+		return leqITCEvents(liftITCEvent(e1.left, e1.n), e2) &&
+			leqITCEvents(liftITCEvent(e1.right, e1.n), e2)
+	}
+
+	return leqITCEvents(liftITCEvent(e1.left, e1.n), liftITCEvent(e2.left, e2.n)) &&
+		leqITCEvents(liftITCEvent(e1.right, e1.n), liftITCEvent(e2.right, e2.n))
+}
+
+func joinITCEvents(e1, e2 *itcEvent) *itcEvent {
+	if e1.left == nil && e2.left == nil {
+		if e1.n > e2.n {
+			return e1
+		}
+
+		return e2
+	}
+
+	if e1.left == nil {
+		e1 = &itcEvent{n: e1.n, left: &itcEvent{}, right: &itcEvent{}}
+	}
+
+	if e2.left == nil {
+		e2 = &itcEvent{n: e2.n, left: &itcEvent{}, right: &itcEvent{}}
+	}
+
+	if e1.n > e2.n {
+		e1, e2 = e2, e1
+	}
+
+	d := e2.n - e1.n
+	return newITCEventNode(
+		e1.n,
+		joinITCEvents(e1.left, liftITCEvent(e2.left, d)),
+		joinITCEvents(e1.right, liftITCEvent(e2.right, d)),
+	)
+}
+
+func equalITCEvents(e1, e2 *itcEvent) bool {
+	if e1.n != e2.n || (e1.left == nil) != (e2.left == nil) {
+		return false
+	}
+
+	if e1.left == nil {
+		return true
+	}
+
+	return equalITCEvents(e1.left, e2.left) && equalITCEvents(e1.right, e2.right)
+}
+
+// fillITC tries to inflate the event tree, without growing it, by filling in
+// the parts of it that the id owns.
+func fillITC(i *itcID, e *itcEvent) *itcEvent {
+	if isITCIDZero(i) {
+		return e
+	}
+
+	if isITCIDOne(i) {
+		return &itcEvent{n: maxITCEvent(e)}
+	}
+
+	if e.left == nil {
+		return e
+	}
+
+	if isITCIDOne(i.left) {
+		right := fillITC(i.right, e.right)
+		n := maxITCEvent(e.left)
+		if m := minITCEvent(right); m > n {
+			n = m
+		}
+
+		return newITCEventNode(e.n, &itcEvent{n: n}, right)
+	}
+
+	if isITCIDOne(i.right) {
+		left := fillITC(i.left, e.left)
+		n := maxITCEvent(e.right)
+		if m := minITCEvent(left); m > n {
+			n = m
+		}
+
+		return newITCEventNode(e.n, left, &itcEvent{n: n})
+	}
+
+	return newITCEventNode(e.n, fillITC(i.left, e.left), fillITC(i.right, e.right))
+}
+
+// growITC inflates the event tree for the id, picking the option that grows
+// the tree the least. It returns the new tree and the cost of growing it.
+func growITC(i *itcID, e *itcEvent) (*itcEvent, uint64) {
+	if e.left == nil {
+		if isITCIDOne(i) {
+			return &itcEvent{n: e.n + 1}, 0
+		}
+
+		grown, cost := growITC(i, &itcEvent{n: e.n, left: &itcEvent{}, right: &itcEvent{}})
+		return grown, cost + itcGrowCost
+	}
+
+	if isITCIDZero(i.left) {
+		right, cost := growITC(i.right, e.right)
+		return &itcEvent{n: e.n, left: e.left, right: right}, cost + 1
+	}
+
+	if isITCIDZero(i.right) {
+		left, cost := growITC(i.left, e.left)
+		return &itcEvent{n: e.n, left: left, right: e.right}, cost + 1
+	}
+
+	left, costLeft := growITC(i.left, e.left)
+	right, costRight := growITC(i.right, e.right)
+
+	if costLeft < costRight {
+		return &itcEvent{n: e.n, left: left, right: e.right}, costLeft + 1
+	}
+
+	return &itcEvent{n: e.n, left: e.left, right: right}, costRight + 1
+}
+
+func marshalITCID(i *itcID, data []byte) []byte {
+	if i.leaf {
+		return append(data, i.value)
+	}
+
+	data = append(data, 2)
+	data = marshalITCID(i.left, data)
+	return marshalITCID(i.right, data)
+}
+
+func unmarshalITCID(data []byte) (*itcID, []byte, error) {
+	if len(data) == 0 {
+		return nil, nil, errMalformedITC
+	}
+
+	switch data[0] {
+	case 0:
+		return itcIDZero, data[1:], nil
+	case 1:
+		return itcIDOne, data[1:], nil
+	case 2:
+		left, data, err := unmarshalITCID(data[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		right, data, err := unmarshalITCID(data)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return &itcID{left: left, right: right}, data, nil
+	default:
+		return nil, nil, errMalformedITC
+	}
+}
+
+func marshalITCEvent(e *itcEvent, data []byte) []byte {
+	if e.left == nil {
+		data = append(data, 0)
+		return binary.AppendUvarint(data, e.n)
+	}
+
+	data = append(data, 1)
+	data = binary.AppendUvarint(data, e.n)
+	data = marshalITCEvent(e.left, data)
+	return marshalITCEvent(e.right, data)
+}
+
+func unmarshalITCEvent(data []byte) (*itcEvent, []byte, error) {
+	if len(data) == 0 || data[0] > 1 {
+		return nil, nil, errMalformedITC
+	}
+
+	isLeaf := data[0] == 0
+	n, size := binary.Uvarint(data[1:])
+	if size <= 0 {
+		return nil, nil, errMalformedITC
+	}
+
+	data = data[1+size:]
+	if isLeaf {
+		return &itcEvent{n: n}, data, nil
+	}
+
+	left, data, err := unmarshalITCEvent(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	right, data, err := unmarshalITCEvent(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &itcEvent{n: n, left: left, right: right}, data, nil
+}
@@ -0,0 +1,100 @@
+package causality_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/luma/pith/rapport/causality"
+)
+
+var _ = Describe("ITC", func() {
+	var a, b *ITC
+
+	BeforeEach(func() {
+		a, b = SeedITC().Fork()
+	})
+
+	Describe("Event()", func() {
+		It("orders the new stamp after the old one", func() {
+			a2 := a.Event()
+
+			Expect(a.Compare(a2)).To(Equal(OrderLess))
+			Expect(a2.Compare(a)).To(Equal(OrderGreater))
+		})
+
+		It("produces concurrent stamps on forked replicas", func() {
+			a = a.Event()
+			b = b.Event()
+
+			Expect(a.Compare(b)).To(Equal(OrderNone))
+			Expect(a.Leq(b)).To(BeFalse())
+			Expect(b.Leq(a)).To(BeFalse())
+		})
+
+		It("is a no-op for anonymous stamps", func() {
+			p := a.Peek()
+
+			Expect(p.IsAnonymous()).To(BeTrue())
+			Expect(p.Event().Compare(p)).To(Equal(OrderEqual))
+		})
+	})
+
+	Describe("Join()", func() {
+		It("sees the events of both stamps", func() {
+			a = a.Event()
+			b = b.Event().Event()
+			c := a.Join(b.Peek())
+
+			Expect(a.Leq(c)).To(BeTrue())
+			Expect(b.Leq(c)).To(BeTrue())
+			Expect(c.Compare(a)).To(Equal(OrderGreater))
+		})
+
+		It("reclaims the id of a retired replica", func() {
+			b1, b2 := b.Fork()
+			b1 = b1.Event()
+			b2 = b2.Event()
+			a = a.Join(b1).Join(b2)
+
+			data, err := a.Marshal()
+			Expect(err).ToNot(HaveOccurred())
+
+			seed, err := SeedITC().Event().Marshal()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(data)).To(BeNumerically("<=", len(seed)+4))
+
+			Expect(a.Event().Compare(a)).To(Equal(OrderGreater))
+		})
+	})
+
+	Describe("Peek()", func() {
+		It("carries causal information without an id", func() {
+			a = a.Event()
+			b = b.Join(a.Peek())
+
+			Expect(a.Leq(b)).To(BeTrue())
+			Expect(b.Event().Compare(a)).To(Equal(OrderGreater))
+		})
+	})
+
+	Describe("Marshal()", func() {
+		It("round trips through UnmarshalITC()", func() {
+			a = a.Event().Event()
+			b = b.Event()
+			c := a.Join(b.Peek()).Event()
+
+			data, err := c.Marshal()
+			Expect(err).ToNot(HaveOccurred())
+
+			c2, err := UnmarshalITC(data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c2.Compare(c)).To(Equal(OrderEqual))
+			Expect(c2.IsAnonymous()).To(BeFalse())
+		})
+
+		It("rejects malformed data", func() {
+			_, err := UnmarshalITC([]byte{2, 1})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -92,6 +92,14 @@ func (v *VersionVector) Get(actor string) (LamportTime, bool) {
 	return time, exists
 }
 
+// Includes indicates whether the event has been witnessed by this
+// VersionVector.
+//
+func (v *VersionVector) Includes(e Event) bool {
+	t, exists := v.Get(e.Actor)
+	return exists && t >= e.Time
+}
+
 // IsEmpty returns true if the version vector is empty
 func (v *VersionVector) IsEmpty() bool {
 	return len(v.dots) == 0
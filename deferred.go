@@ -46,3 +46,44 @@ func (d *DeferredMap) Clone() *DeferredMap {
 
 	return &deferredMap
 }
+
+// Find returns the DeferredSet whose version is equal to version, or nil if
+// there isn't one.
+//
+func (d DeferredMap) Find(version *causality.VersionVector) *DeferredSet {
+	if deferred, exists := d[version]; exists {
+		return deferred
+	}
+
+	for other, deferred := range d {
+		if other.Compare(version) == causality.OrderEqual {
+			return deferred
+		}
+	}
+
+	return nil
+}
+
+// Equal indicates whether d and other defer the same members with the same
+// versions.
+//
+func (d DeferredMap) Equal(other DeferredMap) bool {
+	if len(d) != len(other) {
+		return false
+	}
+
+	for version, deferred := range d {
+		otherDeferred := other.Find(version)
+		if otherDeferred == nil || len(otherDeferred.Members) != len(deferred.Members) {
+			return false
+		}
+
+		for member := range deferred.Members {
+			if !otherDeferred.Members[member] {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,112 @@
+package rapport
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrDumpChecksum is returned when restoring a dump whose checksum doesn't
+	// match its contents
+	ErrDumpChecksum = errors.New("Dump checksum does not match, it may be corrupt")
+
+	dumpChecksumTable = crc64.MakeTable(crc64.ECMA)
+)
+
+// Dump serialises value to bytes that can be restored with Restore. The dump
+// records the ProtoVersion that it was made with and a checksum of the
+// segments so that corruption can be detected.
+//
+func Dump(value Value) ([]byte, error) {
+	segments, err := value.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	segmentsDump := &SegmentsDump{
+		ProtoVersion: ProtoVersion,
+		Segments:     segments,
+	}
+
+	data, err := segmentsDump.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	valueDump := &ValueDump{
+		Checksum: crc64.Checksum(data, dumpChecksumTable),
+		Segments: data,
+	}
+
+	return valueDump.Marshal()
+}
+
+// Restore verifies a dump made with Dump and returns its segments. Dumps made
+// with a different major version of the protocol are rejected.
+//
+func Restore(data []byte) ([]*Segment, error) {
+	valueDump := &ValueDump{}
+	if err := valueDump.Unmarshal(data); err != nil {
+		return nil, err
+	}
+
+	if crc64.Checksum(valueDump.Segments, dumpChecksumTable) != valueDump.Checksum {
+		return nil, ErrDumpChecksum
+	}
+
+	segmentsDump := &SegmentsDump{}
+	if err := segmentsDump.Unmarshal(valueDump.Segments); err != nil {
+		return nil, err
+	}
+
+	if err := checkProtoVersion(segmentsDump.ProtoVersion); err != nil {
+		return nil, err
+	}
+
+	return segmentsDump.Segments, nil
+}
+
+// RestoreValue restores a dump made with Dump into value
+func RestoreValue(data []byte, value Value) error {
+	segments, err := Restore(data)
+	if err != nil {
+		return err
+	}
+
+	return value.Unmarshal(segments)
+}
+
+// checkProtoVersion returns an error if version isn't compatible with
+// ProtoVersion, i.e. it has a different major version.
+//
+func checkProtoVersion(version string) error {
+	major, err := protoMajorVersion(version)
+	if err != nil {
+		return err
+	}
+
+	current, err := protoMajorVersion(ProtoVersion)
+	if err != nil {
+		return err
+	}
+
+	if major != current {
+		return fmt.Errorf("Dump is from protocol version %s, which is incompatible with %s", version, ProtoVersion)
+	}
+
+	return nil
+}
+
+func protoMajorVersion(version string) (int, error) {
+	major := strings.SplitN(version, ".", 2)[0]
+
+	v, err := strconv.Atoi(major)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid protocol version: %q", version)
+	}
+
+	return v, nil
+}
@@ -0,0 +1,83 @@
+package rapport_test
+
+import (
+	"hash/crc64"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/luma/pith/rapport"
+)
+
+var _ = Describe("Dump", func() {
+	var set *AWSet
+	var data []byte
+
+	BeforeEach(func() {
+		set = CreateAWSet()
+		set.Add([]string{"foo", "bar"}, "replica1")
+
+		var err error
+		data, err = Dump(set)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	dumpWithVersion := func(version string) []byte {
+		segments, err := set.Marshal()
+		Expect(err).ToNot(HaveOccurred())
+
+		segmentsData, err := (&SegmentsDump{
+			ProtoVersion: version,
+			Segments:     segments,
+		}).Marshal()
+		Expect(err).ToNot(HaveOccurred())
+
+		valueData, err := (&ValueDump{
+			Checksum: crc64.Checksum(segmentsData, crc64.MakeTable(crc64.ECMA)),
+			Segments: segmentsData,
+		}).Marshal()
+		Expect(err).ToNot(HaveOccurred())
+
+		return valueData
+	}
+
+	It("restores the value", func() {
+		restored := CreateAWSet()
+		Expect(RestoreValue(data, restored)).To(Succeed())
+		Expect(restored.Values()).To(ConsistOf("foo", "bar"))
+	})
+
+	It("records the protocol version", func() {
+		valueDump := &ValueDump{}
+		Expect(valueDump.Unmarshal(data)).To(Succeed())
+
+		segmentsDump := &SegmentsDump{}
+		Expect(segmentsDump.Unmarshal(valueDump.Segments)).To(Succeed())
+		Expect(segmentsDump.ProtoVersion).To(Equal(ProtoVersion))
+	})
+
+	It("rejects corrupt dumps", func() {
+		valueDump := &ValueDump{}
+		Expect(valueDump.Unmarshal(data)).To(Succeed())
+		valueDump.Checksum++
+
+		corrupt, err := valueDump.Marshal()
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = Restore(corrupt)
+		Expect(err).To(Equal(ErrDumpChecksum))
+	})
+
+	It("accepts dumps from the same major version", func() {
+		_, err := Restore(dumpWithVersion("1.9.2"))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("rejects dumps from a different major version", func() {
+		_, err := Restore(dumpWithVersion("2.0.0"))
+		Expect(err).To(HaveOccurred())
+
+		_, err = Restore(dumpWithVersion("nope"))
+		Expect(err).To(HaveOccurred())
+	})
+})
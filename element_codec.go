@@ -0,0 +1,82 @@
+package rapport
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// ElementCodec encodes set elements to, and decodes them from, the bytes that
+// are used in segment key suffixes.
+//
+type ElementCodec[T any] interface {
+	Encode(value T) []byte
+	Decode(data []byte) (T, error)
+}
+
+var (
+	// StringCodec encodes string elements as their bytes
+	StringCodec ElementCodec[string] = stringCodec{}
+
+	// Int64Codec encodes int64 elements as 8 big-endian bytes, with the sign
+	// bit flipped so that the encoded elements sort in numeric order
+	Int64Codec ElementCodec[int64] = int64Codec{}
+
+	// Uint64Codec encodes uint64 elements as 8 big-endian bytes
+	Uint64Codec ElementCodec[uint64] = uint64Codec{}
+)
+
+type stringCodec struct{}
+
+func (stringCodec) Encode(value string) []byte {
+	return []byte(value)
+}
+
+func (stringCodec) Decode(data []byte) (string, error) {
+	return string(data), nil
+}
+
+type int64Codec struct{}
+
+func (int64Codec) Encode(value int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(value)^(1<<63))
+}
+
+func (int64Codec) Decode(data []byte) (int64, error) {
+	if len(data) != 8 {
+		return 0, fmt.Errorf("Expected 8 bytes for an int64 element, got %d", len(data))
+	}
+
+	return int64(binary.BigEndian.Uint64(data) ^ (1 << 63)), nil
+}
+
+type uint64Codec struct{}
+
+func (uint64Codec) Encode(value uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, value)
+}
+
+func (uint64Codec) Decode(data []byte) (uint64, error) {
+	if len(data) != 8 {
+		return 0, fmt.Errorf("Expected 8 bytes for a uint64 element, got %d", len(data))
+	}
+
+	return binary.BigEndian.Uint64(data), nil
+}
+
+// ElementCodecFuncs adapts a pair of functions into an ElementCodec, which is
+// handy for composite elements.
+//
+type ElementCodecFuncs[T any] struct {
+	EncodeFunc func(value T) []byte
+	DecodeFunc func(data []byte) (T, error)
+}
+
+// Encode encodes value with EncodeFunc
+func (c ElementCodecFuncs[T]) Encode(value T) []byte {
+	return c.EncodeFunc(value)
+}
+
+// Decode decodes data with DecodeFunc
+func (c ElementCodecFuncs[T]) Decode(data []byte) (T, error) {
+	return c.DecodeFunc(data)
+}
@@ -0,0 +1,116 @@
+package rapport
+
+// flagToken is the only element that the set backing a flag ever contains
+const flagToken = "F"
+
+// EWFlag is an Enable-Wins Flag. Enabling the flag adds a dot for the replica
+// and disabling it removes every dot that has been observed, exactly like an
+// AWSet with a single element. If the flag is enabled and disabled
+// concurrently then enable wins.
+//
+// A new EWFlag is disabled.
+//
+type EWFlag struct {
+	set *AWSet
+}
+
+// CreateEWFlag returns a new, disabled, EWFlag.
+//
+func CreateEWFlag() *EWFlag {
+	return &EWFlag{
+		set: CreateAWSet(),
+	}
+}
+
+// Enable enables the flag for a specific replica
+func (f *EWFlag) Enable(replica string) {
+	f.set.AddOne(flagToken, replica)
+}
+
+// Disable disables the flag
+func (f *EWFlag) Disable() {
+	f.set.RemoveOne(flagToken)
+}
+
+// Reset disables the flag, which is it's initial state
+func (f *EWFlag) Reset() {
+	f.Disable()
+}
+
+// Value returns true if the flag is enabled
+func (f *EWFlag) Value() bool {
+	return f.set.Contains(flagToken)
+}
+
+// Merge another EWFlag into this one
+//
+func (f *EWFlag) Merge(crdt CRDT) {
+	other := crdt.(*EWFlag)
+	f.set.Merge(other.set)
+}
+
+// Marshal serialises the flag data to bytes
+func (f *EWFlag) Marshal() ([]*Segment, error) {
+	return f.set.Marshal()
+}
+
+// Unmarshal deserialises the flag data from bytes
+func (f *EWFlag) Unmarshal(data []*Segment) error {
+	return f.set.Unmarshal(data)
+}
+
+// DWFlag is a Disable-Wins Flag. It's the dual of the EWFlag, disabling the
+// flag adds a dot for the replica and enabling it removes every dot that has
+// been observed. If the flag is enabled and disabled concurrently then disable
+// wins.
+//
+// A new DWFlag is enabled.
+//
+type DWFlag struct {
+	set *AWSet
+}
+
+// CreateDWFlag returns a new, enabled, DWFlag.
+//
+func CreateDWFlag() *DWFlag {
+	return &DWFlag{
+		set: CreateAWSet(),
+	}
+}
+
+// Enable enables the flag
+func (f *DWFlag) Enable() {
+	f.set.RemoveOne(flagToken)
+}
+
+// Disable disables the flag for a specific replica
+func (f *DWFlag) Disable(replica string) {
+	f.set.AddOne(flagToken, replica)
+}
+
+// Reset enables the flag, which is it's initial state
+func (f *DWFlag) Reset() {
+	f.Enable()
+}
+
+// Value returns true if the flag is enabled
+func (f *DWFlag) Value() bool {
+	return !f.set.Contains(flagToken)
+}
+
+// Merge another DWFlag into this one
+//
+func (f *DWFlag) Merge(crdt CRDT) {
+	other := crdt.(*DWFlag)
+	f.set.Merge(other.set)
+}
+
+// Marshal serialises the flag data to bytes
+func (f *DWFlag) Marshal() ([]*Segment, error) {
+	return f.set.Marshal()
+}
+
+// Unmarshal deserialises the flag data from bytes
+func (f *DWFlag) Unmarshal(data []*Segment) error {
+	return f.set.Unmarshal(data)
+}
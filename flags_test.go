@@ -0,0 +1,106 @@
+package rapport_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/luma/pith/rapport"
+)
+
+var _ = Describe("EWFlag", func() {
+	var flag1, flag2 *EWFlag
+
+	JustBeforeEach(func() {
+		flag1 = CreateEWFlag()
+		flag2 = CreateEWFlag()
+	})
+
+	It("starts disabled", func() {
+		Expect(flag1.Value()).To(BeFalse())
+	})
+
+	It("can be enabled and disabled", func() {
+		flag1.Enable("replica1")
+		Expect(flag1.Value()).To(BeTrue())
+
+		flag1.Disable()
+		Expect(flag1.Value()).To(BeFalse())
+	})
+
+	It("propagates disables that observed the enable", func() {
+		flag1.Enable("replica1")
+		flag2.Merge(flag1)
+		flag2.Disable()
+
+		flag1.Merge(flag2)
+
+		Expect(flag1.Value()).To(BeFalse())
+	})
+
+	It("enable wins when enabled and disabled concurrently", func() {
+		flag1.Enable("replica1")
+		flag2.Merge(flag1)
+
+		flag1.Enable("replica1")
+		flag2.Disable()
+
+		flag1.Merge(flag2)
+		flag2.Merge(flag1)
+
+		Expect(flag1.Value()).To(BeTrue())
+		Expect(flag2.Value()).To(BeTrue())
+	})
+
+	It("round trips through Marshal() and Unmarshal()", func() {
+		flag1.Enable("replica1")
+		segments, err := flag1.Marshal()
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(flag2.Unmarshal(segments)).To(Succeed())
+		Expect(flag2.Value()).To(BeTrue())
+	})
+})
+
+var _ = Describe("DWFlag", func() {
+	var flag1, flag2 *DWFlag
+
+	JustBeforeEach(func() {
+		flag1 = CreateDWFlag()
+		flag2 = CreateDWFlag()
+	})
+
+	It("starts enabled", func() {
+		Expect(flag1.Value()).To(BeTrue())
+	})
+
+	It("can be disabled and enabled", func() {
+		flag1.Disable("replica1")
+		Expect(flag1.Value()).To(BeFalse())
+
+		flag1.Enable()
+		Expect(flag1.Value()).To(BeTrue())
+	})
+
+	It("disable wins when enabled and disabled concurrently", func() {
+		flag1.Disable("replica1")
+		flag2.Merge(flag1)
+
+		flag1.Disable("replica1")
+		flag2.Enable()
+
+		flag1.Merge(flag2)
+		flag2.Merge(flag1)
+
+		Expect(flag1.Value()).To(BeFalse())
+		Expect(flag2.Value()).To(BeFalse())
+	})
+
+	It("round trips through Marshal() and Unmarshal()", func() {
+		flag1.Disable("replica1")
+		segments, err := flag1.Marshal()
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(flag2.Unmarshal(segments)).To(Succeed())
+		Expect(flag2.Value()).To(BeFalse())
+	})
+})
@@ -0,0 +1,109 @@
+package rapport
+
+import (
+	"sync"
+
+	"github.com/luma/pith/rapport/marshalling"
+)
+
+// GCounter is a Grow-Only counter. It can increment, but not decrement. Merging
+// takes the maximum value that has been seen for every replica.
+//
+type GCounter struct {
+	replicaId string
+
+	value *marshalling.GCounterValue
+	l     sync.RWMutex
+}
+
+// CreateGCounter returns a new, zeroed, GCounter for a specific replica.
+//
+func CreateGCounter(replicaId string) *GCounter {
+	return &GCounter{
+		replicaId: replicaId,
+		value:     marshalling.CreateGCounter(replicaId),
+	}
+}
+
+// Incr increments the counter by 1 and returns the new value
+func (g *GCounter) Incr() int64 {
+	g.l.Lock()
+	value := g.value.Incr(g.replicaId)
+	g.l.Unlock()
+
+	return value
+}
+
+// IncrBy increments the counter by amount and returns the new value. As the
+// counter can only grow, amounts that are not positive are ignored.
+//
+func (g *GCounter) IncrBy(amount int64) int64 {
+	g.l.Lock()
+	value := g.value.IncrBy(g.replicaId, amount)
+	g.l.Unlock()
+
+	return value
+}
+
+// Value returns the current value of the counter
+func (g *GCounter) Value() int64 {
+	g.l.RLock()
+	value := g.value.Value()
+	g.l.RUnlock()
+
+	return value
+}
+
+// Merge another GCounter into this one
+//
+func (g *GCounter) Merge(crdt CRDT) {
+	other := crdt.(*GCounter)
+
+	g.l.Lock()
+	other.l.RLock()
+
+	defer func() {
+		g.l.Unlock()
+		other.l.RUnlock()
+	}()
+
+	for id, incVal := range other.value.Inc {
+		if localInc, exists := g.value.Inc[id]; !exists || localInc < incVal {
+			g.value.Inc[id] = incVal
+		}
+	}
+}
+
+// Marshal serialises the counter data to bytes
+func (g *GCounter) Marshal() ([]*Segment, error) {
+	g.l.RLock()
+	v, err := g.value.Marshal()
+	g.l.RUnlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	segment := &Segment{
+		Value: v,
+	}
+	return []*Segment{segment}, nil
+}
+
+// Unmarshal deserialises the counter data from bytes
+func (g *GCounter) Unmarshal(data []*Segment) error {
+	value := &marshalling.GCounterValue{}
+	if err := value.Unmarshal(data[0].Value); err != nil {
+		return err
+	}
+
+	if value.Inc == nil {
+		value.Inc = make(map[string]int64)
+	}
+
+	g.l.Lock()
+	g.value = value
+	g.l.Unlock()
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package rapport_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/luma/pith/rapport"
+)
+
+var _ = Describe("GCounter", func() {
+	var counter *GCounter
+
+	JustBeforeEach(func() {
+		counter = CreateGCounter("replica1")
+	})
+
+	It("starts at zero", func() {
+		Expect(counter.Value()).To(Equal(int64(0)))
+	})
+
+	Describe("Incr()", func() {
+		It("increments the counter by 1", func() {
+			Expect(counter.Incr()).To(Equal(int64(1)))
+			Expect(counter.Incr()).To(Equal(int64(2)))
+			Expect(counter.Value()).To(Equal(int64(2)))
+		})
+	})
+
+	Describe("IncrBy()", func() {
+		It("increments the counter by the amount", func() {
+			Expect(counter.IncrBy(5)).To(Equal(int64(5)))
+			Expect(counter.Value()).To(Equal(int64(5)))
+		})
+
+		It("ignores amounts that would decrease the counter", func() {
+			counter.IncrBy(5)
+			Expect(counter.IncrBy(-3)).To(Equal(int64(5)))
+			Expect(counter.IncrBy(0)).To(Equal(int64(5)))
+		})
+	})
+
+	Describe("Merge()", func() {
+		It("sums the counts from different replicas", func() {
+			counter2 := CreateGCounter("replica2")
+			counter.IncrBy(3)
+			counter2.IncrBy(4)
+
+			counter.Merge(counter2)
+			counter2.Merge(counter)
+
+			Expect(counter.Value()).To(Equal(int64(7)))
+			Expect(counter2.Value()).To(Equal(int64(7)))
+		})
+
+		It("takes the maximum count for each replica", func() {
+			counter2 := CreateGCounter("replica2")
+			counter.IncrBy(3)
+			counter2.Merge(counter)
+			counter.IncrBy(2)
+
+			counter2.Merge(counter)
+			counter.Merge(counter2)
+
+			Expect(counter.Value()).To(Equal(int64(5)))
+			Expect(counter2.Value()).To(Equal(int64(5)))
+		})
+
+		It("is idempotent", func() {
+			counter2 := CreateGCounter("replica2")
+			counter2.IncrBy(4)
+
+			counter.Merge(counter2)
+			counter.Merge(counter2)
+
+			Expect(counter.Value()).To(Equal(int64(4)))
+		})
+	})
+
+	Describe("Marshal()", func() {
+		It("round trips through Unmarshal()", func() {
+			counter.IncrBy(3)
+			segments, err := counter.Marshal()
+			Expect(err).ToNot(HaveOccurred())
+
+			counter2 := CreateGCounter("replica1")
+			Expect(counter2.Unmarshal(segments)).To(Succeed())
+			Expect(counter2.Value()).To(Equal(int64(3)))
+
+			counter2.Incr()
+			Expect(counter2.Value()).To(Equal(int64(4)))
+		})
+	})
+})
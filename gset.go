@@ -0,0 +1,152 @@
+package rapport
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/luma/pith/keys"
+)
+
+// GSet is a Grow-Only Set. Values can be added, but never removed. Once an
+// element is in the set it's there for good.
+//
+type GSet struct {
+	entries map[string]bool
+	l       sync.RWMutex
+}
+
+// CreateGSet returns a new, empty GSet.
+//
+func CreateGSet() *GSet {
+	return &GSet{
+		entries: make(map[string]bool),
+	}
+}
+
+// AddOne adds a single element to the set. It returns true if the element was
+// added, otherwise it returns false.
+//
+func (g *GSet) AddOne(value string) bool {
+	g.l.Lock()
+	_, alreadyExists := g.entries[value]
+	g.entries[value] = true
+	g.l.Unlock()
+
+	return !alreadyExists
+}
+
+// Add adds multiple elements to the set. It returns the number of elements
+// that were added.
+//
+func (g *GSet) Add(values []string) int {
+	added := 0
+
+	for _, value := range values {
+		if g.AddOne(value) {
+			added++
+		}
+	}
+
+	return added
+}
+
+// Values returns the set elements
+func (g *GSet) Values() []string {
+	g.l.RLock()
+	values := make([]string, 0, len(g.entries))
+	for value := range g.entries {
+		values = append(values, value)
+	}
+	g.l.RUnlock()
+
+	return values
+}
+
+// Cardinality returns the number of elements in the set
+func (g *GSet) Cardinality() int {
+	g.l.RLock()
+	defer g.l.RUnlock()
+	return len(g.entries)
+}
+
+// IsEmpty returns true if the set contains no elements
+func (g *GSet) IsEmpty() bool {
+	return g.Cardinality() == 0
+}
+
+// Contains returns true if the value is in the set
+func (g *GSet) Contains(value string) bool {
+	g.l.RLock()
+	_, exists := g.entries[value]
+	g.l.RUnlock()
+
+	return exists
+}
+
+// Each iterates over the set calling the provided function at each iteraction
+func (g *GSet) Each(fn func(string)) {
+	g.l.RLock()
+	defer g.l.RUnlock()
+
+	for value := range g.entries {
+		fn(value)
+	}
+}
+
+// Merge another GSet into this one. The result is the union of both sets.
+//
+func (g *GSet) Merge(crdt CRDT) {
+	other := crdt.(*GSet)
+
+	g.l.Lock()
+	other.l.RLock()
+
+	defer func() {
+		g.l.Unlock()
+		other.l.RUnlock()
+	}()
+
+	for value := range other.entries {
+		g.entries[value] = true
+	}
+}
+
+// Marshal serialises the set data to bytes
+func (g *GSet) Marshal() ([]*Segment, error) {
+	g.l.RLock()
+	defer g.l.RUnlock()
+
+	segments := make([]*Segment, 0, 1+len(g.entries))
+
+	// The header segment carries no data, but means that an empty set still
+	// produces a segment
+	segments = append(segments, &Segment{})
+
+	for value := range g.entries {
+		segments = append(segments, &Segment{
+			KeySuffix: keys.Make(EntriesKey, []byte(value)),
+		})
+	}
+
+	return segments, nil
+}
+
+// Unmarshal deserialises the set data from bytes
+func (g *GSet) Unmarshal(data []*Segment) error {
+	entries := make(map[string]bool)
+
+	for _, s := range data[1:] {
+		if s.KeySuffix[0] != EntriesKey[0] {
+			return fmt.Errorf("Unexpected key suffix for set: %s", s.KeySuffix)
+		}
+
+		// Strip off the key sigil and add the entry
+		entries[string(s.KeySuffix[2:])] = true
+	}
+
+	g.l.Lock()
+	g.entries = entries
+	g.l.Unlock()
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package rapport_test
+
+import (
+	"sort"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/luma/pith/rapport"
+)
+
+var _ = Describe("GSet", func() {
+	var set *GSet
+
+	JustBeforeEach(func() {
+		set = CreateGSet()
+		set.AddOne("foo")
+	})
+
+	It("adds values", func() {
+		Expect(set.Add([]string{"foo", "bar"})).To(Equal(1))
+		Expect(set.Contains("bar")).To(BeTrue())
+		Expect(set.Cardinality()).To(Equal(2))
+	})
+
+	It("merges to the union of both sets", func() {
+		set2 := CreateGSet()
+		set2.Add([]string{"bar", "baz"})
+
+		set.Merge(set2)
+
+		values := set.Values()
+		sort.Strings(values)
+		Expect(values).To(Equal([]string{"bar", "baz", "foo"}))
+	})
+
+	It("round trips through Marshal() and Unmarshal()", func() {
+		set.AddOne("bar")
+		segments, err := set.Marshal()
+		Expect(err).ToNot(HaveOccurred())
+
+		set2 := CreateGSet()
+		Expect(set2.Unmarshal(segments)).To(Succeed())
+
+		values := set2.Values()
+		sort.Strings(values)
+		Expect(values).To(Equal([]string{"bar", "foo"}))
+	})
+})
@@ -0,0 +1,353 @@
+package rapport
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/luma/pith/keys"
+	"github.com/luma/pith/rapport/causality"
+)
+
+// LWWBias decides whether an add or a remove wins when an element of a
+// LWWElementSet was added and removed with exactly the same timestamp.
+type LWWBias uint8
+
+const (
+	// BiasAdd indicates that adds win over removes with the same timestamp
+	BiasAdd LWWBias = iota
+
+	// BiasRemove indicates that removes win over adds with the same timestamp
+	BiasRemove
+)
+
+// LWWElementSet is a Last-Write-Wins element set. Each element carries the
+// timestamps of its newest add and remove, the newer of the two decides
+// whether the element is in the set. Ties are broken by the set's bias rather
+// than by panicking like the LWWRegister does.
+//
+// As with the LWWRegister the timestamps are wall clock times, so the ordering
+// can be unstable if there's too much disagreement between replica clocks.
+//
+type LWWElementSet struct {
+	bias    LWWBias
+	entries map[string]*LWWElement
+	l       sync.RWMutex
+}
+
+// CreateLWWElementSet returns a new, empty LWWElementSet that resolves ties
+// using bias.
+//
+func CreateLWWElementSet(bias LWWBias) *LWWElementSet {
+	return &LWWElementSet{
+		bias:    bias,
+		entries: make(map[string]*LWWElement),
+	}
+}
+
+// Bias returns the bias used to resolve adds and removes with the same
+// timestamp
+func (s *LWWElementSet) Bias() LWWBias {
+	return s.bias
+}
+
+// AddOne adds a single element to the set using the current time. It returns
+// true if the element was added, otherwise it returns false.
+//
+// The replica is unused as the timestamp alone orders the operations, it's
+// accepted so that LWWElementSet satisfies the Set contract.
+//
+func (s *LWWElementSet) AddOne(value string, replica string) bool {
+	return s.AddOneAt(value, time.Now().UTC())
+}
+
+// AddOneAt adds a single element to the set as of time t. It returns true if
+// the element was not in the set before but is now.
+//
+func (s *LWWElementSet) AddOneAt(value string, t time.Time) bool {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	entry := s.entry(value)
+	wasPresent := s.isPresent(entry)
+
+	if ts := t.UnixNano(); ts > entry.Added {
+		entry.Added = ts
+	}
+
+	return !wasPresent && s.isPresent(entry)
+}
+
+// Add adds multiple elements to the set. It returns the number of elements
+// that were added.
+//
+func (s *LWWElementSet) Add(values []string, replica string) int {
+	added := 0
+	now := time.Now().UTC()
+
+	for _, value := range values {
+		if s.AddOneAt(value, now) {
+			added++
+		}
+	}
+
+	return added
+}
+
+// RemoveOne removes a single element from the set using the current time.
+//
+// A LWWElementSet does not track causality so the VersionVector that is
+// returned is always empty, it will be nil if nothing was removed.
+//
+func (s *LWWElementSet) RemoveOne(value string) *causality.VersionVector {
+	if !s.RemoveOneAt(value, time.Now().UTC()) {
+		return nil
+	}
+
+	return causality.CreateVersionVector()
+}
+
+// RemoveOneAt removes a single element from the set as of time t. It returns
+// true if the element was in the set before but isn't now.
+//
+func (s *LWWElementSet) RemoveOneAt(value string, t time.Time) bool {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	entry := s.entry(value)
+	wasPresent := s.isPresent(entry)
+
+	if ts := t.UnixNano(); ts > entry.Removed {
+		entry.Removed = ts
+	}
+
+	return wasPresent && !s.isPresent(entry)
+}
+
+// Remove removes a number of values from the set and returns the number
+// of elements that were removed.
+//
+func (s *LWWElementSet) Remove(values []string) int {
+	removed := 0
+	now := time.Now().UTC()
+
+	for _, value := range values {
+		if s.RemoveOneAt(value, now) {
+			removed++
+		}
+	}
+
+	return removed
+}
+
+// Values returns the set elements
+func (s *LWWElementSet) Values() []string {
+	values := make([]string, 0)
+
+	s.Each(func(value string) {
+		values = append(values, value)
+	})
+
+	return values
+}
+
+// Cardinality returns the number of elements in the set
+func (s *LWWElementSet) Cardinality() int {
+	count := 0
+
+	s.Each(func(value string) {
+		count++
+	})
+
+	return count
+}
+
+// IsEmpty returns true if the set contains no elements
+func (s *LWWElementSet) IsEmpty() bool {
+	return s.Cardinality() == 0
+}
+
+// Contains returns true if the value is in the set
+func (s *LWWElementSet) Contains(value string) bool {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	entry, exists := s.entries[value]
+	return exists && s.isPresent(entry)
+}
+
+// Each iterates over the set calling the provided function at each iteraction
+func (s *LWWElementSet) Each(fn func(string)) {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	for value, entry := range s.entries {
+		if s.isPresent(entry) {
+			fn(value)
+		}
+	}
+}
+
+// Union returns a new set that is the union between this
+// set and the other
+func (s *LWWElementSet) Union(other Set, replica string) Set {
+	union := CreateLWWElementSet(s.bias)
+	union.Add(s.Values(), replica)
+	union.Add(other.Values(), replica)
+	return union
+}
+
+// Intersect returns a new set that is the intersection between this
+// set and the other
+func (s *LWWElementSet) Intersect(other Set, replica string) Set {
+	intersection := CreateLWWElementSet(s.bias)
+
+	for _, value := range s.Values() {
+		if other.Contains(value) {
+			intersection.AddOne(value, replica)
+		}
+	}
+
+	return intersection
+}
+
+// IsSubsetOf indicates whether this set is a subset of the other
+func (s *LWWElementSet) IsSubsetOf(other Set) bool {
+	for _, value := range s.Values() {
+		if !other.Contains(value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Difference returns a new set that is the difference between this
+// set and the other
+func (s *LWWElementSet) Difference(other Set) []string {
+	diff := make([]string, 0)
+
+	for _, value := range s.Values() {
+		if !other.Contains(value) {
+			diff = append(diff, value)
+		}
+	}
+
+	return diff
+}
+
+// Merge another LWWElementSet into this one. The newest add and remove
+// timestamps are kept for each element.
+//
+func (s *LWWElementSet) Merge(crdt CRDT) {
+	other := crdt.(*LWWElementSet)
+
+	s.l.Lock()
+	other.l.RLock()
+
+	defer func() {
+		s.l.Unlock()
+		other.l.RUnlock()
+	}()
+
+	for value, otherEntry := range other.entries {
+		entry := s.entry(value)
+
+		if otherEntry.Added > entry.Added {
+			entry.Added = otherEntry.Added
+		}
+
+		if otherEntry.Removed > entry.Removed {
+			entry.Removed = otherEntry.Removed
+		}
+	}
+}
+
+// Marshal serialises the set data to bytes. Each element is serialised as
+// it's own Segment so that a large set can be partially loaded.
+//
+func (s *LWWElementSet) Marshal() ([]*Segment, error) {
+	s.l.RLock()
+	defer s.l.RUnlock()
+
+	segments := make([]*Segment, 0, 1+len(s.entries))
+
+	segments = append(segments, &Segment{
+		Value: []byte{byte(s.bias)},
+	})
+
+	for value, entry := range s.entries {
+		b, err := entry.Marshal()
+		if err != nil {
+			return nil, err
+		}
+
+		segments = append(segments, &Segment{
+			KeySuffix: keys.Make(EntriesKey, []byte(value)),
+			Value:     b,
+		})
+	}
+
+	return segments, nil
+}
+
+// Unmarshal deserialises the set data from bytes
+func (s *LWWElementSet) Unmarshal(data []*Segment) error {
+	if len(data[0].Value) != 1 {
+		return fmt.Errorf("Unexpected header for set: %v", data[0].Value)
+	}
+
+	bias := LWWBias(data[0].Value[0])
+	entries := make(map[string]*LWWElement)
+
+	for _, seg := range data[1:] {
+		if seg.KeySuffix[0] != EntriesKey[0] {
+			return fmt.Errorf("Unexpected key suffix for set: %s", seg.KeySuffix)
+		}
+
+		entry := &LWWElement{}
+		if err := entry.Unmarshal(seg.Value); err != nil {
+			return err
+		}
+
+		// Strip off the key sigil and add the entry
+		entries[string(seg.KeySuffix[2:])] = entry
+	}
+
+	s.l.Lock()
+	s.bias = bias
+	s.entries = entries
+	s.l.Unlock()
+
+	return nil
+}
+
+// entry returns the timestamps for value, creating them if needed.
+//
+// This method is not thread safe
+//
+func (s *LWWElementSet) entry(value string) *LWWElement {
+	entry, exists := s.entries[value]
+	if !exists {
+		entry = &LWWElement{}
+		s.entries[value] = entry
+	}
+
+	return entry
+}
+
+// isPresent indicates whether entry represents a value that is in the set
+//
+// This method is not thread safe
+//
+func (s *LWWElementSet) isPresent(entry *LWWElement) bool {
+	if entry.Added == 0 {
+		return false
+	}
+
+	if entry.Added == entry.Removed {
+		return s.bias == BiasAdd
+	}
+
+	return entry.Added > entry.Removed
+}
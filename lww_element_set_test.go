@@ -0,0 +1,155 @@
+package rapport_test
+
+import (
+	"sort"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/luma/pith/rapport"
+)
+
+var _ = Describe("LWWElementSet", func() {
+	var set *LWWElementSet
+	var bias LWWBias
+	var t0 time.Time
+
+	BeforeEach(func() {
+		bias = BiasAdd
+		t0 = time.Now().UTC()
+	})
+
+	JustBeforeEach(func() {
+		set = CreateLWWElementSet(bias)
+		set.AddOneAt("foo", t0)
+	})
+
+	It("satisfies the Set contract", func() {
+		var s Set = set
+		Expect(s.Contains("foo")).To(BeTrue())
+	})
+
+	Describe("AddOneAt()", func() {
+		It("adds the value", func() {
+			Expect(set.Contains("foo")).To(BeTrue())
+			Expect(set.Cardinality()).To(Equal(1))
+		})
+
+		It("returns false when the value is already in the set", func() {
+			Expect(set.AddOneAt("foo", t0.Add(time.Second))).To(BeFalse())
+		})
+
+		It("re-adds a value that was removed earlier", func() {
+			set.RemoveOneAt("foo", t0.Add(time.Second))
+			Expect(set.AddOneAt("foo", t0.Add(2*time.Second))).To(BeTrue())
+			Expect(set.Contains("foo")).To(BeTrue())
+		})
+
+		It("does not re-add a value that was removed later", func() {
+			set.RemoveOneAt("foo", t0.Add(2*time.Second))
+			Expect(set.AddOneAt("foo", t0.Add(time.Second))).To(BeFalse())
+			Expect(set.Contains("foo")).To(BeFalse())
+		})
+	})
+
+	Describe("RemoveOneAt()", func() {
+		It("removes the value", func() {
+			Expect(set.RemoveOneAt("foo", t0.Add(time.Second))).To(BeTrue())
+			Expect(set.Contains("foo")).To(BeFalse())
+		})
+
+		It("ignores removes that are older than the add", func() {
+			Expect(set.RemoveOneAt("foo", t0.Add(-time.Second))).To(BeFalse())
+			Expect(set.Contains("foo")).To(BeTrue())
+		})
+	})
+
+	Describe("RemoveOne()", func() {
+		It("returns nil when the value is not in the set", func() {
+			Expect(set.RemoveOne("wut")).To(BeNil())
+		})
+	})
+
+	Context("with an add bias", func() {
+		It("keeps values that were added and removed at the same time", func() {
+			set.RemoveOneAt("foo", t0)
+			Expect(set.Contains("foo")).To(BeTrue())
+		})
+	})
+
+	Context("with a remove bias", func() {
+		BeforeEach(func() {
+			bias = BiasRemove
+		})
+
+		It("drops values that were added and removed at the same time", func() {
+			set.RemoveOneAt("foo", t0)
+			Expect(set.Contains("foo")).To(BeFalse())
+		})
+	})
+
+	Describe("Merge()", func() {
+		It("merges additions from both sets", func() {
+			set2 := CreateLWWElementSet(bias)
+			set2.AddOneAt("bar", t0)
+
+			set.Merge(set2)
+
+			values := set.Values()
+			sort.Strings(values)
+			Expect(values).To(Equal([]string{"bar", "foo"}))
+		})
+
+		It("converges on the newest operation for each value", func() {
+			set2 := CreateLWWElementSet(bias)
+			set2.Merge(set)
+
+			set2.RemoveOneAt("foo", t0.Add(time.Second))
+			set.AddOneAt("bar", t0.Add(time.Second))
+			set2.RemoveOneAt("bar", t0.Add(2*time.Second))
+
+			set.Merge(set2)
+			set2.Merge(set)
+
+			Expect(set.Values()).To(BeEmpty())
+			Expect(set2.Values()).To(BeEmpty())
+		})
+
+		It("does not panic when timestamps are equal", func() {
+			set2 := CreateLWWElementSet(bias)
+			set2.RemoveOneAt("foo", t0)
+
+			Expect(func() { set.Merge(set2) }).ToNot(Panic())
+			Expect(set.Contains("foo")).To(BeTrue())
+		})
+	})
+
+	Describe("Marshal()", func() {
+		BeforeEach(func() {
+			bias = BiasRemove
+		})
+
+		It("marshals each element as a separate segment", func() {
+			set.AddOneAt("bar", t0)
+			segments, err := set.Marshal()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(segments).To(HaveLen(3))
+		})
+
+		It("round trips through Unmarshal()", func() {
+			set.AddOneAt("bar", t0)
+			set.RemoveOneAt("bar", t0.Add(time.Second))
+
+			segments, err := set.Marshal()
+			Expect(err).ToNot(HaveOccurred())
+
+			set2 := CreateLWWElementSet(BiasAdd)
+			Expect(set2.Unmarshal(segments)).To(Succeed())
+
+			Expect(set2.Bias()).To(Equal(BiasRemove))
+			Expect(set2.Values()).To(Equal([]string{"foo"}))
+			Expect(set2.AddOneAt("bar", t0)).To(BeFalse())
+		})
+	})
+})
@@ -3,11 +3,25 @@ package rapport
 import (
 	"fmt"
 	"time"
+
+	"github.com/luma/pith/keys"
+	"github.com/luma/pith/rapport/causality"
+)
+
+var (
+	// TimestampKey is the sigil used to deliminate a key that is for a
+	// register's HLC timestamp
+	TimestampKey = []byte("T")
 )
 
 type LWWRegister struct {
 	t     time.Time
 	value string
+
+	// When clock is set the register is ordered by the HLC timestamp, ts,
+	// rather than by t
+	clock *causality.HLC
+	ts    causality.HLCTimestamp
 }
 
 func CreateLWWRegister(initialValue string) *LWWRegister {
@@ -17,7 +31,39 @@ func CreateLWWRegister(initialValue string) *LWWRegister {
 	}
 }
 
+// CreateLWWRegisterWithHLC returns a LWWRegister that orders writes using
+// timestamps from a Hybrid Logical Clock, rather than the time passed to Set.
+// This means that replicas with skewed clocks still converge deterministically.
+//
+func CreateLWWRegisterWithHLC(initialValue string, clock *causality.HLC) *LWWRegister {
+	return &LWWRegister{
+		value: initialValue,
+		t:     time.Now().UTC(),
+		clock: clock,
+		ts:    clock.Now(),
+	}
+}
+
+// Set sets the register to value at time t. Without a HLC writes from the past
+// are rejected. With a HLC t is witnessed by the clock, which always produces a
+// timestamp newer than the current one, so the write is never rejected.
+//
+// A register with a HLC timestamp but no clock, because it was unmarshalled or
+// cloned, is given a clock that has witnessed it's timestamp.
+//
 func (l *LWWRegister) Set(value string, t time.Time) error {
+	if l.clock == nil && !l.ts.IsZero() {
+		l.clock = causality.CreateHLC(nil)
+		l.clock.Update(l.ts)
+	}
+
+	if l.clock != nil {
+		l.ts = l.clock.Update(causality.HLCTimestamp{WallTime: t.UnixNano()})
+		l.t = t
+		l.value = value
+		return nil
+	}
+
 	if t.Before(l.t) {
 		return fmt.Errorf("Cannot set register to a value from the past: %v < %v", t, l.t)
 	}
@@ -31,9 +77,20 @@ func (l *LWWRegister) Get() string {
 	return l.value
 }
 
+// Timestamp returns the HLC timestamp of the current value, this is the zero
+// timestamp if the register isn't using a HLC
+func (l *LWWRegister) Timestamp() causality.HLCTimestamp {
+	return l.ts
+}
+
 func (l *LWWRegister) Merge(crdt CRDT) {
 	otherReg := crdt.(*LWWRegister)
 
+	if l.clock != nil || !l.ts.IsZero() || !otherReg.ts.IsZero() {
+		l.mergeHLC(otherReg)
+		return
+	}
+
 	if l.t.Before(otherReg.t) {
 		l.value = otherReg.value
 		l.t = otherReg.t
@@ -43,16 +100,62 @@ func (l *LWWRegister) Merge(crdt CRDT) {
 	}
 }
 
+// mergeHLC merges another register using the HLC timestamps. Equal timestamps
+// with different values are resolved by picking the greater value, so every
+// replica picks the same one.
+//
+func (l *LWWRegister) mergeHLC(otherReg *LWWRegister) {
+	if l.clock != nil {
+		l.clock.Update(otherReg.ts)
+	}
+
+	order := l.ts.Compare(otherReg.ts)
+	if order == causality.OrderGreater || (order == causality.OrderEqual && otherReg.value <= l.value) {
+		return
+	}
+
+	l.value = otherReg.value
+	l.t = otherReg.t
+	l.ts = otherReg.ts
+}
+
 // Marshal serialises the register data to bytes
 func (l *LWWRegister) Marshal() ([]*Segment, error) {
-	segment := &Segment{
+	segments := []*Segment{{
 		Value: []byte(l.value),
+	}}
+
+	if !l.ts.IsZero() {
+		ts, err := l.ts.Marshal()
+		if err != nil {
+			return nil, err
+		}
+
+		segments = append(segments, &Segment{
+			KeySuffix: keys.Make(TimestampKey, nil),
+			Value:     ts,
+		})
 	}
-	return []*Segment{segment}, nil
+
+	return segments, nil
 }
 
 // Marshal deserialises the register data from bytes
 func (l *LWWRegister) Unmarshal(data []*Segment) error {
+	var ts causality.HLCTimestamp
+
+	for _, s := range data[1:] {
+		if s.KeySuffix[0] != TimestampKey[0] {
+			return fmt.Errorf("Unexpected key suffix for register: %s", s.KeySuffix)
+		}
+
+		var err error
+		if ts, err = causality.UnmarshalHLCTimestamp(s.Value); err != nil {
+			return err
+		}
+	}
+
 	l.value = string(data[0].Value)
+	l.ts = ts
 	return nil
 }
@@ -0,0 +1,101 @@
+package rapport_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/luma/pith/rapport"
+	"github.com/luma/pith/rapport/causality"
+)
+
+var _ = Describe("LWWRegister", func() {
+	Describe("Set()", func() {
+		It("rejects values from the past", func() {
+			reg := CreateLWWRegister("foo")
+			Expect(reg.Set("bar", time.Now().Add(-time.Hour))).ToNot(Succeed())
+			Expect(reg.Get()).To(Equal("foo"))
+		})
+	})
+
+	Context("with a HLC", func() {
+		var now1, now2 int64
+		var reg1, reg2 *LWWRegister
+
+		BeforeEach(func() {
+			now1 = 1000
+			now2 = 500
+
+			reg1 = CreateLWWRegisterWithHLC("foo", causality.CreateHLC(func() int64 { return now1 }))
+			reg2 = CreateLWWRegisterWithHLC("foo", causality.CreateHLC(func() int64 { return now2 }))
+		})
+
+		It("accepts values from the past", func() {
+			Expect(reg1.Set("bar", time.Unix(0, 10))).To(Succeed())
+			Expect(reg1.Get()).To(Equal("bar"))
+		})
+
+		It("orders writes after the newest value it has seen, despite clock skew", func() {
+			reg1.Set("bar", time.Unix(0, now1))
+			reg2.Merge(reg1)
+
+			// reg2's clock is behind, but it has seen reg1's write
+			reg2.Set("baz", time.Unix(0, now2))
+
+			reg1.Merge(reg2)
+			Expect(reg1.Get()).To(Equal("baz"))
+		})
+
+		It("converges on equal timestamps without panicking", func() {
+			clock := func() int64 { return 100 }
+			reg1 = CreateLWWRegisterWithHLC("foo", causality.CreateHLC(clock))
+			reg2 = CreateLWWRegisterWithHLC("bar", causality.CreateHLC(clock))
+
+			Expect(reg1.Timestamp()).To(Equal(reg2.Timestamp()))
+			Expect(func() {
+				reg1.Merge(reg2)
+				reg2.Merge(reg1)
+			}).ToNot(Panic())
+
+			Expect(reg1.Get()).To(Equal("foo"))
+			Expect(reg2.Get()).To(Equal("foo"))
+		})
+
+		It("round trips the timestamp through Marshal() and Unmarshal()", func() {
+			reg1.Set("bar", time.Unix(0, now1))
+			segments, err := reg1.Marshal()
+			Expect(err).ToNot(HaveOccurred())
+
+			reg3 := CreateLWWRegister("")
+			Expect(reg3.Unmarshal(segments)).To(Succeed())
+			Expect(reg3.Get()).To(Equal("bar"))
+			Expect(reg3.Timestamp()).To(Equal(reg1.Timestamp()))
+		})
+
+		It("orders writes to an unmarshalled register after it's timestamp", func() {
+			reg1.Set("bar", time.Unix(0, now1))
+			segments, err := reg1.Marshal()
+			Expect(err).ToNot(HaveOccurred())
+
+			reg3 := CreateLWWRegister("")
+			Expect(reg3.Unmarshal(segments)).To(Succeed())
+			Expect(reg3.Set("a", time.Unix(0, now1))).To(Succeed())
+			Expect(reg3.Timestamp().Before(reg1.Timestamp())).To(BeFalse())
+			Expect(reg3.Timestamp()).ToNot(Equal(reg1.Timestamp()))
+
+			reg1.Merge(reg3)
+			Expect(reg1.Get()).To(Equal("a"))
+		})
+
+		It("keys the timestamp segment with the sigil and a separator", func() {
+			reg1.Set("bar", time.Unix(0, now1))
+			segments, err := reg1.Marshal()
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(segments).To(HaveLen(2))
+			Expect(segments[1].KeySuffix).To(HaveLen(2))
+			Expect(segments[1].KeySuffix[:1]).To(Equal(TimestampKey))
+		})
+	})
+})
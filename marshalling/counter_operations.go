@@ -53,6 +53,101 @@ func (p *PNCounterValue) Value() (total int64) {
 	return total
 }
 
+// CreateIncrementOperation returns an operation that increments a counter by
+// amount for replicaId, a negative amount decrements it.
+//
+func CreateIncrementOperation(replicaId string, amount int64) *Operation {
+	return &Operation{
+		Type:    OperationType_CounterIncrement,
+		Replica: replicaId,
+		Amount:  amount,
+	}
+}
+
+// CreateDecrementOperation returns an operation that decrements a counter by
+// amount for replicaId
+//
+func CreateDecrementOperation(replicaId string, amount int64) *Operation {
+	return CreateIncrementOperation(replicaId, -amount)
+}
+
+// ApplyIncrement applies an increment operation, made by
+// CreateIncrementOperation, to the counter
+//
+func (p *PNCounterValue) ApplyIncrement(op *Operation) int64 {
+	return p.IncrBy(op.Replica, op.Amount)
+}
+
+func CreateGCounter(replicaId string) *GCounterValue {
+	g := &GCounterValue{
+		Inc: make(map[string]int64),
+	}
+
+	g.Inc[replicaId] = int64(0)
+
+	return g
+}
+
+func (g *GCounterValue) Incr(replicaId string) int64 {
+	return g.IncrBy(replicaId, 1)
+}
+
+func (g *GCounterValue) IncrBy(replicaId string, amount int64) int64 {
+	if amount > 0 {
+		g.Inc[replicaId] = g.Inc[replicaId] + amount
+	}
+
+	return g.Value()
+}
+
+func (g *GCounterValue) Value() (total int64) {
+	for _, incVal := range g.Inc {
+		total += incVal
+	}
+
+	return total
+}
+
+func CreateBoundedCounter(replicaId string, floor int64) *BoundedCounterValue {
+	return &BoundedCounterValue{
+		Floor:   floor,
+		Counter: CreatePNCounter(replicaId),
+	}
+}
+
+func CreateBoundedCounterTransfers() *BoundedCounterTransfers {
+	return &BoundedCounterTransfers{
+		To: make(map[string]int64),
+	}
+}
+
+// Value returns the value of the counter, which starts at the floor
+func (b *BoundedCounterValue) Value() int64 {
+	return b.Floor + b.Counter.Value()
+}
+
+func CreateResettableCounter(replicaId string) *ResettableCounterValue {
+	return &ResettableCounterValue{
+		Counter: CreatePNCounter(replicaId),
+		Reset:   CreatePNCounter(replicaId),
+	}
+}
+
+// Value returns the value of the counter, ignoring the increments and
+// decrements that have been reset
+//
+func (r *ResettableCounterValue) Value() (total int64) {
+	for id, incVal := range r.Counter.Inc {
+		total += incVal - r.Reset.Inc[id]
+	}
+
+	for id, decVal := range r.Counter.Dec {
+		total -= decVal - r.Reset.Dec[id]
+	}
+
+	return total
+}
+
 // func (p *PNCounterValue) Merge(crdt CRDT) {
 // 	other := crdt.(*PNCounterValue)
 //
@@ -0,0 +1,54 @@
+package marshalling
+
+// CreateSetAddOperation returns an operation that adds element to a set with
+// the dot, replacing the dots in context.
+//
+func CreateSetAddOperation(replicaId string, element []byte, dot []byte, context []byte) *Operation {
+	return &Operation{
+		Type:    OperationType_SetAdd,
+		Replica: replicaId,
+		Element: element,
+		Dot:     dot,
+		Context: context,
+	}
+}
+
+// CreateSetRemoveOperation returns an operation that removes the dots in
+// context from element.
+//
+func CreateSetRemoveOperation(replicaId string, element []byte, context []byte) *Operation {
+	return &Operation{
+		Type:    OperationType_SetRemove,
+		Replica: replicaId,
+		Element: element,
+		Context: context,
+	}
+}
+
+// CreateRegisterSetOperation returns an operation that sets a last-writer-wins
+// register to value at time t, or at the HLC timestamp made of wallTime and
+// logical.
+//
+func CreateRegisterSetOperation(replicaId string, value string, t int64, wallTime int64, logical uint32) *Operation {
+	return &Operation{
+		Type:     OperationType_RegisterSet,
+		Replica:  replicaId,
+		Value:    value,
+		Time:     t,
+		WallTime: wallTime,
+		Logical:  logical,
+	}
+}
+
+// CreateMVRegisterSetOperation returns an operation that sets a multi-value
+// register to value with the dot, replacing the values in context.
+//
+func CreateMVRegisterSetOperation(replicaId string, value string, dot []byte, context []byte) *Operation {
+	return &Operation{
+		Type:    OperationType_MVRegisterSet,
+		Replica: replicaId,
+		Value:   value,
+		Dot:     dot,
+		Context: context,
+	}
+}
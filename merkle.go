@@ -0,0 +1,433 @@
+package rapport
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+const (
+	// MerkleFanout is the number of children of each internal node of a
+	// MerkleTree. Each level of the tree consumes 4 bits of a key's hash.
+	MerkleFanout = 16
+
+	// DefaultMerkleDepth is the depth of a MerkleTree created with
+	// CreateMerkleTree, it gives 65536 leaves which keeps the leaves small
+	// for values with millions of segments.
+	DefaultMerkleDepth = 4
+
+	maxMerkleDepth = sha256.Size * 2
+)
+
+// MerkleSource is a hash tree that can be walked to find where it differs
+// from another. Paths are the child indexes, one per level, leading from the
+// root to a node.
+//
+// MerkleTree is a local MerkleSource, but a source can just as easily be
+// backed by requests to a remote replica.
+//
+type MerkleSource interface {
+	// Depth is the number of levels below the root
+	Depth() int
+
+	// Root returns the hash of the whole tree
+	Root() ([]byte, error)
+
+	// Children returns the hashes of the children of the node at path
+	Children(path []byte) ([][]byte, error)
+
+	// Leaves returns the key suffixes, and hashes of the values, of the
+	// segments in the leaf at path
+	Leaves(path []byte) (map[string][]byte, error)
+}
+
+// MerkleTree is a hash tree over the segments of a value, keyed by each
+// segment's KeySuffix. Two replicas can compare the root hashes of their trees
+// and, if they differ, walk down the tree to find just the segments that
+// differ.
+//
+// Segments are placed in the tree by the hash of their KeySuffix, so the tree
+// stays balanced and a segment is always at the same place in every replica's
+// tree. Hashes are only recalculated for the parts of the tree that have
+// changed.
+//
+type MerkleTree struct {
+	depth int
+	root  *merkleNode
+	size  int
+	l     sync.RWMutex
+}
+
+type merkleNode struct {
+	// hash is nil for empty nodes, so that they always match
+	hash  []byte
+	dirty bool
+
+	children [MerkleFanout]*merkleNode
+	leaves   map[string][]byte
+}
+
+// CreateMerkleTree returns a new, empty, MerkleTree of the DefaultMerkleDepth
+func CreateMerkleTree() *MerkleTree {
+	tree, _ := CreateMerkleTreeWithDepth(DefaultMerkleDepth)
+	return tree
+}
+
+// CreateMerkleTreeWithDepth returns a new, empty, MerkleTree. Trees can only
+// be compared with trees of the same depth.
+//
+func CreateMerkleTreeWithDepth(depth int) (*MerkleTree, error) {
+	if depth < 1 || depth > maxMerkleDepth {
+		return nil, fmt.Errorf("Merkle tree depth must be between 1 and %d", maxMerkleDepth)
+	}
+
+	return &MerkleTree{
+		depth: depth,
+		root:  &merkleNode{},
+	}, nil
+}
+
+// BuildMerkleTree returns a MerkleTree, of the DefaultMerkleDepth, that
+// contains the segments.
+//
+func BuildMerkleTree(segments []*Segment) *MerkleTree {
+	tree := CreateMerkleTree()
+	for _, s := range segments {
+		tree.Put(s.KeySuffix, s.Value)
+	}
+
+	return tree
+}
+
+// Depth is the number of levels below the root
+func (t *MerkleTree) Depth() int {
+	return t.depth
+}
+
+// Len returns the number of segments in the tree
+func (t *MerkleTree) Len() int {
+	t.l.RLock()
+	defer t.l.RUnlock()
+	return t.size
+}
+
+// Put adds, or updates, the segment with keySuffix
+func (t *MerkleTree) Put(keySuffix []byte, value []byte) {
+	valueHash := sha256.Sum256(value)
+	path := merklePath(keySuffix, t.depth)
+
+	t.l.Lock()
+	defer t.l.Unlock()
+
+	node := t.root
+	node.dirty = true
+
+	for _, i := range path {
+		if node.children[i] == nil {
+			node.children[i] = &merkleNode{}
+		}
+
+		node = node.children[i]
+		node.dirty = true
+	}
+
+	if node.leaves == nil {
+		node.leaves = make(map[string][]byte)
+	}
+
+	if _, exists := node.leaves[string(keySuffix)]; !exists {
+		t.size++
+	}
+
+	node.leaves[string(keySuffix)] = valueHash[:]
+}
+
+// Delete removes the segment with keySuffix. It returns false if there was no
+// such segment.
+//
+func (t *MerkleTree) Delete(keySuffix []byte) bool {
+	path := merklePath(keySuffix, t.depth)
+
+	t.l.Lock()
+	defer t.l.Unlock()
+
+	nodes := make([]*merkleNode, 0, t.depth+1)
+	node := t.root
+
+	for _, i := range path {
+		nodes = append(nodes, node)
+		node = node.children[i]
+
+		if node == nil {
+			return false
+		}
+	}
+
+	if _, exists := node.leaves[string(keySuffix)]; !exists {
+		return false
+	}
+
+	delete(node.leaves, string(keySuffix))
+	t.size--
+
+	node.dirty = true
+	for _, n := range nodes {
+		n.dirty = true
+	}
+
+	return true
+}
+
+// Root returns the hash of the whole tree. An empty tree has a nil hash.
+func (t *MerkleTree) Root() ([]byte, error) {
+	t.l.Lock()
+	defer t.l.Unlock()
+
+	return t.hash(t.root, 0), nil
+}
+
+// Children returns the hashes of the children of the node at path
+func (t *MerkleTree) Children(path []byte) ([][]byte, error) {
+	t.l.Lock()
+	defer t.l.Unlock()
+
+	if len(path) >= t.depth {
+		return nil, fmt.Errorf("Merkle tree path %x is not an internal node", path)
+	}
+
+	node, err := t.find(path)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([][]byte, MerkleFanout)
+	if node == nil {
+		return hashes, nil
+	}
+
+	for i, child := range node.children {
+		if child != nil {
+			hashes[i] = t.hash(child, len(path)+1)
+		}
+	}
+
+	return hashes, nil
+}
+
+// Leaves returns the key suffixes, and hashes of the values, of the segments
+// in the leaf at path
+//
+func (t *MerkleTree) Leaves(path []byte) (map[string][]byte, error) {
+	t.l.RLock()
+	defer t.l.RUnlock()
+
+	if len(path) != t.depth {
+		return nil, fmt.Errorf("Merkle tree path %x is not a leaf", path)
+	}
+
+	node, err := t.find(path)
+	if err != nil {
+		return nil, err
+	}
+
+	leaves := make(map[string][]byte)
+	if node == nil {
+		return leaves, nil
+	}
+
+	for key, valueHash := range node.leaves {
+		leaves[key] = valueHash
+	}
+
+	return leaves, nil
+}
+
+// Diff walks this tree and the other, only descending into nodes whose hashes
+// differ, and returns the key suffixes of the segments that differ. That's
+// those that have been added, removed, or changed, in either tree.
+//
+func (t *MerkleTree) Diff(other MerkleSource) ([][]byte, error) {
+	return DiffMerkleSources(t, other)
+}
+
+// DiffMerkleSources returns the key suffixes of the segments that differ
+// between two MerkleSources, sorted.
+//
+func DiffMerkleSources(a, b MerkleSource) ([][]byte, error) {
+	if a.Depth() != b.Depth() {
+		return nil, fmt.Errorf("Can't compare Merkle trees of depth %d and %d", a.Depth(), b.Depth())
+	}
+
+	rootA, err := a.Root()
+	if err != nil {
+		return nil, err
+	}
+
+	rootB, err := b.Root()
+	if err != nil {
+		return nil, err
+	}
+
+	diff := make([][]byte, 0)
+	if bytes.Equal(rootA, rootB) {
+		return diff, nil
+	}
+
+	diff, err = diffMerkleNodes(a, b, nil, diff)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(diff, func(i, j int) bool {
+		return bytes.Compare(diff[i], diff[j]) < 0
+	})
+
+	return diff, nil
+}
+
+func diffMerkleNodes(a, b MerkleSource, path []byte, diff [][]byte) ([][]byte, error) {
+	if len(path) == a.Depth() {
+		leavesA, err := a.Leaves(path)
+		if err != nil {
+			return nil, err
+		}
+
+		leavesB, err := b.Leaves(path)
+		if err != nil {
+			return nil, err
+		}
+
+		for key, hashA := range leavesA {
+			if hashB, exists := leavesB[key]; !exists || !bytes.Equal(hashA, hashB) {
+				diff = append(diff, []byte(key))
+			}
+		}
+
+		for key := range leavesB {
+			if _, exists := leavesA[key]; !exists {
+				diff = append(diff, []byte(key))
+			}
+		}
+
+		return diff, nil
+	}
+
+	childrenA, err := a.Children(path)
+	if err != nil {
+		return nil, err
+	}
+
+	childrenB, err := b.Children(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < MerkleFanout; i++ {
+		if bytes.Equal(childrenA[i], childrenB[i]) {
+			continue
+		}
+
+		childPath := append(append(make([]byte, 0, len(path)+1), path...), byte(i))
+		diff, err = diffMerkleNodes(a, b, childPath, diff)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return diff, nil
+}
+
+// find returns the node at path, or nil if there isn't one
+//
+// This method is not thread safe
+//
+func (t *MerkleTree) find(path []byte) (*merkleNode, error) {
+	node := t.root
+	for _, i := range path {
+		if int(i) >= MerkleFanout {
+			return nil, fmt.Errorf("Merkle tree path %x is invalid", path)
+		}
+
+		node = node.children[i]
+		if node == nil {
+			return nil, nil
+		}
+	}
+
+	return node, nil
+}
+
+// hash returns the hash of node, recalculating it if it has changed
+//
+// This method is not thread safe
+//
+func (t *MerkleTree) hash(node *merkleNode, level int) []byte {
+	if !node.dirty {
+		return node.hash
+	}
+
+	h := sha256.New()
+	empty := true
+
+	if level == t.depth {
+		keys := make([]string, 0, len(node.leaves))
+		for key := range node.leaves {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var size [binary.MaxVarintLen64]byte
+		for _, key := range keys {
+			n := binary.PutUvarint(size[:], uint64(len(key)))
+			h.Write(size[:n])
+			h.Write([]byte(key))
+			h.Write(node.leaves[key])
+			empty = false
+		}
+	} else {
+		for i, child := range node.children {
+			if child == nil {
+				continue
+			}
+
+			childHash := t.hash(child, level+1)
+			if childHash == nil {
+				continue
+			}
+
+			h.Write([]byte{byte(i)})
+			h.Write(childHash)
+			empty = false
+		}
+	}
+
+	node.dirty = false
+	node.hash = nil
+	if !empty {
+		node.hash = h.Sum(nil)
+	}
+
+	return node.hash
+}
+
+// merklePath returns the path to the leaf for keySuffix, a nibble of the
+// key's hash for each level of the tree.
+//
+func merklePath(keySuffix []byte, depth int) []byte {
+	sum := sha256.Sum256(keySuffix)
+	path := make([]byte, depth)
+
+	for i := range path {
+		b := sum[i/2]
+		if i%2 == 0 {
+			path[i] = b >> 4
+		} else {
+			path[i] = b & 0x0f
+		}
+	}
+
+	return path
+}
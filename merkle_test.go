@@ -0,0 +1,101 @@
+package rapport_test
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/luma/pith/rapport"
+)
+
+var _ = Describe("MerkleTree", func() {
+	var a, b *AWSet
+
+	BeforeEach(func() {
+		a = CreateAWSet()
+		for i := 0; i < 500; i++ {
+			a.AddOne(fmt.Sprintf("value-%d", i), "a")
+		}
+
+		b = CreateAWSet()
+		b.Merge(a)
+	})
+
+	build := func(set *AWSet) *MerkleTree {
+		segments, err := set.Marshal()
+		Expect(err).ToNot(HaveOccurred())
+		return BuildMerkleTree(segments)
+	}
+
+	It("has the same root for the same segments", func() {
+		rootA, err := build(a).Root()
+		Expect(err).ToNot(HaveOccurred())
+
+		rootB, err := build(b).Root()
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(rootA).ToNot(BeNil())
+		Expect(rootA).To(Equal(rootB))
+	})
+
+	It("has a nil root when empty", func() {
+		root, err := CreateMerkleTree().Root()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(root).To(BeNil())
+	})
+
+	It("diffs only the segments that have changed", func() {
+		b.AddOne("new", "b")
+		b.RemoveOne("value-7")
+
+		treeA := build(a)
+		treeB := build(b)
+		Expect(treeB.Len()).To(Equal(treeA.Len()))
+
+		diff, err := treeA.Diff(treeB)
+		Expect(err).ToNot(HaveOccurred())
+
+		keys := make([]string, 0, len(diff))
+		for _, key := range diff {
+			keys = append(keys, string(key))
+		}
+
+		// The header changes along with the added and removed entries
+		Expect(keys).To(HaveLen(3))
+		Expect(keys).To(ContainElement(""))
+		Expect(keys).To(ContainElement(ContainSubstring("new")))
+		Expect(keys).To(ContainElement(ContainSubstring("value-7")))
+	})
+
+	It("returns an empty diff for equal trees", func() {
+		diff, err := build(a).Diff(build(b))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(diff).To(BeEmpty())
+	})
+
+	It("updates hashes incrementally", func() {
+		tree := CreateMerkleTree()
+		tree.Put([]byte("a"), []byte("1"))
+		tree.Put([]byte("b"), []byte("2"))
+		before, _ := tree.Root()
+
+		tree.Put([]byte("c"), []byte("3"))
+		tree.Put([]byte("a"), []byte("changed"))
+		Expect(tree.Delete([]byte("c"))).To(BeTrue())
+		Expect(tree.Delete([]byte("c"))).To(BeFalse())
+
+		tree.Put([]byte("a"), []byte("1"))
+		after, _ := tree.Root()
+		Expect(after).To(Equal(before))
+		Expect(tree.Len()).To(Equal(2))
+	})
+
+	It("can't compare trees of different depths", func() {
+		shallow, err := CreateMerkleTreeWithDepth(2)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, err = CreateMerkleTree().Diff(shallow)
+		Expect(err).To(HaveOccurred())
+	})
+})
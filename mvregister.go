@@ -0,0 +1,263 @@
+package rapport
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/luma/pith/keys"
+	"github.com/luma/pith/rapport/causality"
+)
+
+// mvSibling is a single value of a MVRegister along with the dot, the unique
+// event, of the write that set it
+type mvSibling struct {
+	value string
+	dot   causality.Event
+}
+
+// MVRegister is a Multi-Value Register. Rather than picking a winner when two
+// replicas write concurrently, it keeps every concurrent write as a sibling.
+// Clients can resolve siblings by writing a new value with a causal context
+// that has witnessed them.
+//
+// Each write is tagged with a new dot, and the register keeps a separate
+// causal context of every write it has witnessed. A sibling is only discarded
+// once a context that has witnessed it's dot is merged in, see
+// https://github.com/ricardobcl/Dotted-Version-Vectors
+//
+type MVRegister struct {
+	siblings []*mvSibling
+	context  *causality.DottedVersionVector
+	l        sync.RWMutex
+}
+
+// CreateMVRegister returns a new, empty MVRegister.
+//
+func CreateMVRegister() *MVRegister {
+	return &MVRegister{
+		siblings: make([]*mvSibling, 0),
+		context:  causality.CreateDottedVersionVector(),
+	}
+}
+
+// Values returns the values of every sibling, in sorted order
+func (m *MVRegister) Values() []string {
+	m.l.RLock()
+	values := make([]string, 0, len(m.siblings))
+	for _, sibling := range m.siblings {
+		values = append(values, sibling.value)
+	}
+	m.l.RUnlock()
+
+	sort.Strings(values)
+	return values
+}
+
+// Context returns the causal context of the register, this has witnessed
+// every sibling. Writing with this context will replace all current siblings.
+//
+func (m *MVRegister) Context() *causality.DottedVersionVector {
+	m.l.RLock()
+	defer m.l.RUnlock()
+
+	return m.context.Clone()
+}
+
+// Set writes value for replica, replacing every sibling the register currently
+// holds. It returns the dot of the new value.
+//
+func (m *MVRegister) Set(value string, replica string) causality.Event {
+	return m.SetWithContext(value, replica, m.Context())
+}
+
+// SetWithContext writes value for replica, replacing only the siblings that
+// context has witnessed. Siblings that are concurrent with context are kept.
+// It returns the dot of the new value.
+//
+func (m *MVRegister) SetWithContext(value string, replica string, context *causality.DottedVersionVector) causality.Event {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	// The dot is new to the register, even if the context is stale
+	dot := m.context.Next(replica)
+
+	m.replace(context)
+	m.siblings = append(m.siblings, &mvSibling{
+		value: value,
+		dot:   dot,
+	})
+
+	m.context.Join(context)
+	return dot
+}
+
+// Reset discards every sibling. Writes that other replicas make concurrently
+// are kept when the registers are merged.
+//
+func (m *MVRegister) Reset() {
+	m.l.Lock()
+	m.siblings = make([]*mvSibling, 0)
+	m.l.Unlock()
+}
+
+// Merge another MVRegister into this one. Siblings that the other register
+// has witnessed, but no longer holds, are discarded.
+//
+func (m *MVRegister) Merge(crdt CRDT) {
+	other := crdt.(*MVRegister)
+
+	m.l.Lock()
+	other.l.RLock()
+
+	defer func() {
+		m.l.Unlock()
+		other.l.RUnlock()
+	}()
+
+	siblings := make([]*mvSibling, 0, len(m.siblings)+len(other.siblings))
+	for _, sibling := range m.siblings {
+		if other.hasDot(sibling.dot) || !other.context.Contains(sibling.dot) {
+			siblings = append(siblings, sibling)
+		}
+	}
+
+	for _, sibling := range other.siblings {
+		if !m.hasDot(sibling.dot) && !m.context.Contains(sibling.dot) {
+			siblings = append(siblings, &mvSibling{
+				value: sibling.value,
+				dot:   sibling.dot,
+			})
+		}
+	}
+
+	m.siblings = siblings
+	m.context.Join(other.context)
+}
+
+// Marshal serialises the register data to bytes. The header segment holds the
+// register's causal context and each sibling is a separate Segment, keyed by
+// it's dot.
+//
+func (m *MVRegister) Marshal() ([]*Segment, error) {
+	m.l.RLock()
+	defer m.l.RUnlock()
+
+	segments := make([]*Segment, 0, 1+len(m.siblings))
+
+	c, err := m.context.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	segments = append(segments, &Segment{
+		Value: c,
+	})
+
+	for _, sibling := range m.siblings {
+		d, err := marshalDot(sibling.dot)
+		if err != nil {
+			return nil, err
+		}
+
+		segments = append(segments, &Segment{
+			KeySuffix: keys.Make(EntriesKey, d),
+			Value:     []byte(sibling.value),
+		})
+	}
+
+	return segments, nil
+}
+
+// Unmarshal deserialises the register data from bytes
+func (m *MVRegister) Unmarshal(data []*Segment) error {
+	context := causality.CreateDottedVersionVector()
+	if len(data[0].Value) > 0 {
+		if err := context.Unmarshal(data[0].Value); err != nil {
+			return err
+		}
+	}
+
+	siblings := make([]*mvSibling, 0, len(data)-1)
+
+	for _, s := range data[1:] {
+		if s.KeySuffix[0] != EntriesKey[0] {
+			return fmt.Errorf("Unexpected key suffix for register: %s", s.KeySuffix)
+		}
+
+		// Strip off the key sigil to get at the dot
+		dot, err := unmarshalDot(s.KeySuffix[2:])
+		if err != nil {
+			return err
+		}
+
+		siblings = append(siblings, &mvSibling{
+			value: string(s.Value),
+			dot:   dot,
+		})
+
+		context.Add(dot)
+	}
+
+	m.l.Lock()
+	m.siblings = siblings
+	m.context = context
+	m.l.Unlock()
+
+	return nil
+}
+
+// replace discards the siblings that context has witnessed
+//
+// This method is not thread safe
+//
+func (m *MVRegister) replace(context *causality.DottedVersionVector) {
+	siblings := make([]*mvSibling, 0, len(m.siblings)+1)
+	for _, sibling := range m.siblings {
+		if !context.Contains(sibling.dot) {
+			siblings = append(siblings, sibling)
+		}
+	}
+
+	m.siblings = siblings
+}
+
+// hasDot returns true if the register holds a sibling with dot
+//
+// This method is not thread safe
+//
+func (m *MVRegister) hasDot(dot causality.Event) bool {
+	for _, sibling := range m.siblings {
+		if sibling.dot == dot {
+			return true
+		}
+	}
+
+	return false
+}
+
+// marshalDot serialises a dot as a VersionVector with a single event
+func marshalDot(dot causality.Event) ([]byte, error) {
+	version := causality.CreateVersionVector()
+	version.Witness(dot.Actor, dot.Time)
+	return version.Marshal()
+}
+
+// unmarshalDot is the inverse of marshalDot
+func unmarshalDot(data []byte) (causality.Event, error) {
+	version, err := causality.UnmarshalVersionVector(data)
+	if err != nil {
+		return causality.Event{}, err
+	}
+
+	dots := make([]causality.Event, 0, 1)
+	version.REach(func(actor string, t causality.LamportTime) {
+		dots = append(dots, causality.Event{Actor: actor, Time: t})
+	})
+
+	if len(dots) != 1 {
+		return causality.Event{}, fmt.Errorf("Malformed dot for register: %s", data)
+	}
+
+	return dots[0], nil
+}
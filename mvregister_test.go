@@ -0,0 +1,130 @@
+package rapport_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/luma/pith/rapport"
+)
+
+var _ = Describe("MVRegister", func() {
+	var reg1, reg2 *MVRegister
+
+	JustBeforeEach(func() {
+		reg1 = CreateMVRegister()
+		reg2 = CreateMVRegister()
+		reg1.Set("foo", "replica1")
+	})
+
+	Describe("Set()", func() {
+		It("sets the value", func() {
+			Expect(reg1.Values()).To(Equal([]string{"foo"}))
+		})
+
+		It("replaces the current value", func() {
+			reg1.Set("bar", "replica1")
+			Expect(reg1.Values()).To(Equal([]string{"bar"}))
+		})
+	})
+
+	Describe("Merge()", func() {
+		It("replaces values that have been witnessed", func() {
+			reg2.Merge(reg1)
+			reg2.Set("bar", "replica2")
+
+			reg1.Merge(reg2)
+
+			Expect(reg1.Values()).To(Equal([]string{"bar"}))
+		})
+
+		It("keeps concurrent writes as siblings", func() {
+			reg2.Merge(reg1)
+			reg1.Set("bar", "replica1")
+			reg2.Set("baz", "replica2")
+
+			reg1.Merge(reg2)
+			reg2.Merge(reg1)
+
+			Expect(reg1.Values()).To(Equal([]string{"bar", "baz"}))
+			Expect(reg2.Values()).To(Equal([]string{"bar", "baz"}))
+		})
+
+		It("keeps writes from replicas that have never synced", func() {
+			reg2.Set("bar", "replica2")
+
+			Expect(func() { reg1.Merge(reg2) }).ToNot(Panic())
+			Expect(reg1.Values()).To(Equal([]string{"bar", "foo"}))
+		})
+
+		It("is idempotent", func() {
+			reg2.Merge(reg1)
+			reg2.Merge(reg1)
+			reg1.Merge(reg2)
+
+			Expect(reg1.Values()).To(Equal([]string{"foo"}))
+			Expect(reg2.Values()).To(Equal([]string{"foo"}))
+		})
+	})
+
+	Describe("SetWithContext()", func() {
+		It("resolves the siblings that the context has witnessed", func() {
+			reg2.Set("bar", "replica2")
+			reg1.Merge(reg2)
+
+			reg1.SetWithContext("baz", "replica1", reg1.Context())
+
+			Expect(reg1.Values()).To(Equal([]string{"baz"}))
+		})
+
+		It("keeps siblings that the context has not witnessed", func() {
+			context := reg1.Context()
+
+			reg2.Set("bar", "replica2")
+			reg1.Merge(reg2)
+
+			reg1.SetWithContext("baz", "replica1", context)
+
+			Expect(reg1.Values()).To(Equal([]string{"bar", "baz"}))
+		})
+
+		It("keeps the replica's own siblings that the context has not witnessed", func() {
+			context := reg2.Context()
+			reg2.Set("bar", "replica2")
+			reg2.SetWithContext("baz", "replica2", context)
+			Expect(reg2.Values()).To(Equal([]string{"bar", "baz"}))
+
+			reg1.Merge(reg2)
+			reg2.Merge(reg1)
+
+			Expect(reg1.Values()).To(Equal([]string{"bar", "baz", "foo"}))
+			Expect(reg2.Values()).To(Equal([]string{"bar", "baz", "foo"}))
+		})
+
+		It("doesn't resurrect siblings that were replaced", func() {
+			reg2.Merge(reg1)
+			reg1.Set("bar", "replica1")
+
+			reg1.Merge(reg2)
+			Expect(reg1.Values()).To(Equal([]string{"bar"}))
+		})
+	})
+
+	Describe("Marshal()", func() {
+		It("marshals each sibling as a separate segment", func() {
+			reg2.Set("bar", "replica2")
+			reg1.Merge(reg2)
+
+			segments, err := reg1.Marshal()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(segments).To(HaveLen(3))
+
+			reg3 := CreateMVRegister()
+			Expect(reg3.Unmarshal(segments)).To(Succeed())
+			Expect(reg3.Values()).To(Equal([]string{"bar", "foo"}))
+
+			reg3.Set("baz", "replica3")
+			reg1.Merge(reg3)
+			Expect(reg1.Values()).To(Equal([]string{"baz"}))
+		})
+	})
+})
@@ -0,0 +1,220 @@
+package rapport
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/luma/pith/rapport/causality"
+	"github.com/luma/pith/rapport/marshalling"
+)
+
+// OperationApplier is implemented by Values that can be replicated as
+// operation-based CRDTs. Operations are produced by the Value's Op mutators,
+// like PNCounter.IncrByOp, and must be applied to other replicas exactly once
+// and in causal order, see CausalBuffer. The buffer also sets the replica of
+// operations that the mutators leave blank.
+//
+type OperationApplier interface {
+	ApplyOperation(op *marshalling.Operation) error
+}
+
+func unexpectedOperation(op *marshalling.Operation, value interface{}) error {
+	return fmt.Errorf("Cannot apply %v operation to %T", op.Type, value)
+}
+
+// IncrByOp increments the counter, like IncrBy, and returns the operation
+func (p *PNCounter) IncrByOp(amount int64) *marshalling.Operation {
+	p.IncrBy(amount)
+	return marshalling.CreateIncrementOperation(p.replicaId, amount)
+}
+
+// DecrByOp decrements the counter, like DecrBy, and returns the operation
+func (p *PNCounter) DecrByOp(amount int64) *marshalling.Operation {
+	p.DecrBy(amount)
+	return marshalling.CreateDecrementOperation(p.replicaId, amount)
+}
+
+// ApplyOperation applies an operation from another replica's counter
+func (p *PNCounter) ApplyOperation(op *marshalling.Operation) error {
+	if op.Type != marshalling.OperationType_CounterIncrement {
+		return unexpectedOperation(op, p)
+	}
+
+	p.l.Lock()
+	p.value.ApplyIncrement(op)
+	p.l.Unlock()
+
+	return nil
+}
+
+// AddOneOp adds a single element to the set, like AddOne, and returns the
+// operation. The operation carries the element's new dot and the dots that it
+// replaced.
+//
+func (a *AWSetOf[T]) AddOneOp(value T, replica string) (*marshalling.Operation, error) {
+	delta := a.AddOneDelta(value, replica)
+
+	dot, err := delta.entries[value].Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	context := causality.CreateVersionVector()
+	for version := range delta.deferred {
+		context = version
+	}
+
+	contextData, err := context.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	return marshalling.CreateSetAddOperation(replica, a.codec.Encode(value), dot, contextData), nil
+}
+
+// RemoveOneOp removes a single element from the set, like RemoveOne, and
+// returns the operation. It returns nil if the element wasn't in the set.
+//
+func (a *AWSetOf[T]) RemoveOneOp(value T) (*marshalling.Operation, error) {
+	version := a.RemoveOne(value)
+	if version == nil {
+		return nil, nil
+	}
+
+	context, err := version.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	return marshalling.CreateSetRemoveOperation("", a.codec.Encode(value), context), nil
+}
+
+// ApplyOperation applies an operation from another replica's set. Only the
+// dots in the operation's context are removed, so an element that has been
+// concurrently added by another replica stays in the set.
+//
+func (a *AWSetOf[T]) ApplyOperation(op *marshalling.Operation) error {
+	if op.Type != marshalling.OperationType_SetAdd && op.Type != marshalling.OperationType_SetRemove {
+		return unexpectedOperation(op, a)
+	}
+
+	value, err := a.codec.Decode(op.Element)
+	if err != nil {
+		return err
+	}
+
+	context, err := causality.UnmarshalVersionVector(op.Context)
+	if err != nil {
+		return err
+	}
+
+	a.l.Lock()
+	defer a.l.Unlock()
+
+	entry := a.entries[value]
+	if entry != nil {
+		entry = entry.Subtract(context)
+	} else {
+		entry = causality.CreateVersionVector()
+	}
+
+	if op.Type == marshalling.OperationType_SetAdd {
+		dot, err := causality.UnmarshalVersionVector(op.Dot)
+		if err != nil {
+			return err
+		}
+
+		entry.Merge(dot)
+		a.Version.Merge(dot)
+	}
+
+	if entry.IsEmpty() {
+		delete(a.entries, value)
+	} else {
+		a.entries[value] = entry
+	}
+
+	a.dirty[value] = struct{}{}
+	return nil
+}
+
+// SetOp sets the register, like Set, and returns the operation
+func (l *LWWRegister) SetOp(value string, t time.Time) (*marshalling.Operation, error) {
+	if err := l.Set(value, t); err != nil {
+		return nil, err
+	}
+
+	return marshalling.CreateRegisterSetOperation("", value, l.t.UnixNano(), l.ts.WallTime, l.ts.Logical), nil
+}
+
+// ApplyOperation applies an operation from another replica's register, the
+// write wins if it's newer than the register's value.
+//
+func (l *LWWRegister) ApplyOperation(op *marshalling.Operation) error {
+	if op.Type != marshalling.OperationType_RegisterSet {
+		return unexpectedOperation(op, l)
+	}
+
+	l.Merge(&LWWRegister{
+		t:     time.Unix(0, op.Time).UTC(),
+		value: op.Value,
+		ts:    causality.HLCTimestamp{WallTime: op.WallTime, Logical: op.Logical},
+	})
+
+	return nil
+}
+
+// SetOp sets the register, like Set, and returns the operation
+func (m *MVRegister) SetOp(value string, replica string) (*marshalling.Operation, error) {
+	context := m.Context()
+	c, err := context.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	dot, err := marshalDot(m.SetWithContext(value, replica, context))
+	if err != nil {
+		return nil, err
+	}
+
+	return marshalling.CreateMVRegisterSetOperation(replica, value, dot, c), nil
+}
+
+// ApplyOperation applies an operation from another replica's register. The
+// new value replaces every sibling that the operation's context has witnessed.
+//
+func (m *MVRegister) ApplyOperation(op *marshalling.Operation) error {
+	if op.Type != marshalling.OperationType_MVRegisterSet {
+		return unexpectedOperation(op, m)
+	}
+
+	dot, err := unmarshalDot(op.Dot)
+	if err != nil {
+		return err
+	}
+
+	context := causality.CreateDottedVersionVector()
+	if len(op.Context) > 0 {
+		if err := context.Unmarshal(op.Context); err != nil {
+			return err
+		}
+	}
+
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	if m.context.Contains(dot) {
+		// The write has already been applied, and maybe replaced since
+		return nil
+	}
+
+	m.replace(context)
+	m.siblings = append(m.siblings, &mvSibling{
+		value: op.Value,
+		dot:   dot,
+	})
+
+	m.context.Join(context)
+	m.context.Add(dot)
+	return nil
+}
@@ -0,0 +1,197 @@
+package rapport_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/luma/pith/rapport"
+	"github.com/luma/pith/rapport/marshalling"
+)
+
+var _ = Describe("Operations", func() {
+	Describe("CausalBuffer", func() {
+		var a, b *PNCounter
+		var bufferA, bufferB *CausalBuffer
+
+		BeforeEach(func() {
+			a = CreatePNCounter("a")
+			b = CreatePNCounter("b")
+			bufferA = CreateCausalBuffer("a", a)
+			bufferB = CreateCausalBuffer("b", b)
+		})
+
+		stamp := func(buffer *CausalBuffer, op *marshalling.Operation) *marshalling.Operation {
+			Expect(buffer.Stamp(op)).To(Succeed())
+			return op
+		}
+
+		It("applies operations exactly once", func() {
+			op := stamp(bufferA, a.IncrByOp(5))
+
+			applied, err := bufferB.Deliver(op)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(applied).To(Equal(1))
+
+			applied, err = bufferB.Deliver(op)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(applied).To(Equal(0))
+
+			Expect(b.Value()).To(Equal(int64(5)))
+		})
+
+		It("holds operations until their dependencies arrive", func() {
+			op1 := stamp(bufferA, a.IncrByOp(5))
+			op2 := stamp(bufferA, a.DecrByOp(2))
+			op3 := stamp(bufferA, a.IncrByOp(1))
+
+			applied, err := bufferB.Deliver(op3)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(applied).To(Equal(0))
+
+			_, err = bufferB.Deliver(op2)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bufferB.Pending()).To(Equal(2))
+			Expect(b.Value()).To(Equal(int64(0)))
+
+			applied, err = bufferB.Deliver(op1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(applied).To(Equal(3))
+			Expect(bufferB.Pending()).To(Equal(0))
+			Expect(b.Value()).To(Equal(int64(4)))
+		})
+
+		It("holds operations that depend on other replicas", func() {
+			c := CreatePNCounter("c")
+			bufferC := CreateCausalBuffer("c", c)
+
+			opA := stamp(bufferA, a.IncrByOp(1))
+			_, err := bufferB.Deliver(opA)
+			Expect(err).ToNot(HaveOccurred())
+
+			// B's op has seen A's, so C must apply A's first
+			opB := stamp(bufferB, b.IncrByOp(2))
+
+			applied, err := bufferC.Deliver(opB)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(applied).To(Equal(0))
+
+			applied, err = bufferC.Deliver(opA)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(applied).To(Equal(2))
+			Expect(c.Value()).To(Equal(int64(3)))
+		})
+
+		It("skips operations that can't be applied", func() {
+			op := stamp(bufferA, marshalling.CreateSetRemoveOperation("", []byte("foo"), nil))
+
+			_, err := bufferB.Deliver(op)
+			Expect(err).To(HaveOccurred())
+			Expect(bufferB.Pending()).To(Equal(0))
+		})
+	})
+
+	Describe("AWSet", func() {
+		var a, b *AWSet
+		var bufferA, bufferB *CausalBuffer
+
+		BeforeEach(func() {
+			a = CreateAWSet()
+			b = CreateAWSet()
+			bufferA = CreateCausalBuffer("a", a)
+			bufferB = CreateCausalBuffer("b", b)
+		})
+
+		It("replicates adds and removes", func() {
+			add, err := a.AddOneOp("foo", "a")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bufferA.Stamp(add)).To(Succeed())
+
+			remove, err := a.RemoveOneOp("foo")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bufferA.Stamp(remove)).To(Succeed())
+
+			_, err = bufferB.Deliver(remove)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = bufferB.Deliver(add)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(b.Contains("foo")).To(BeFalse())
+		})
+
+		It("keeps concurrent adds when an element is removed", func() {
+			add, err := a.AddOneOp("foo", "a")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bufferA.Stamp(add)).To(Succeed())
+
+			_, err = bufferB.Deliver(add)
+			Expect(err).ToNot(HaveOccurred())
+
+			remove, err := a.RemoveOneOp("foo")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bufferA.Stamp(remove)).To(Succeed())
+
+			concurrentAdd, err := b.AddOneOp("foo", "b")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(bufferB.Stamp(concurrentAdd)).To(Succeed())
+
+			_, err = bufferA.Deliver(concurrentAdd)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = bufferB.Deliver(remove)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(a.Values()).To(ConsistOf("foo"))
+			Expect(b.Values()).To(ConsistOf("foo"))
+		})
+
+		It("returns nil when removing a missing element", func() {
+			op, err := a.RemoveOneOp("nope")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(op).To(BeNil())
+		})
+	})
+
+	Describe("Registers", func() {
+		It("applies newer LWWRegister writes", func() {
+			now := time.Now()
+			a := CreateLWWRegister("")
+			b := CreateLWWRegister("")
+
+			op, err := a.SetOp("foo", now.Add(time.Second))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b.ApplyOperation(op)).To(Succeed())
+			Expect(b.Get()).To(Equal("foo"))
+
+			Expect(b.Set("bar", now.Add(time.Minute))).To(Succeed())
+			Expect(b.ApplyOperation(op)).To(Succeed())
+			Expect(b.Get()).To(Equal("bar"))
+		})
+
+		It("keeps concurrent MVRegister writes as siblings", func() {
+			a := CreateMVRegister()
+			b := CreateMVRegister()
+
+			opA, err := a.SetOp("foo", "a")
+			Expect(err).ToNot(HaveOccurred())
+			opB, err := b.SetOp("bar", "b")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(a.ApplyOperation(opB)).To(Succeed())
+			Expect(b.ApplyOperation(opA)).To(Succeed())
+
+			Expect(a.Values()).To(Equal([]string{"bar", "foo"}))
+			Expect(b.Values()).To(Equal(a.Values()))
+
+			opA, err = a.SetOp("baz", "a")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b.ApplyOperation(opA)).To(Succeed())
+			Expect(b.Values()).To(Equal([]string{"baz"}))
+		})
+
+		It("rejects operations of the wrong type", func() {
+			op := marshalling.CreateIncrementOperation("a", 1)
+			Expect(CreateMVRegister().ApplyOperation(op)).ToNot(Succeed())
+		})
+	})
+})
@@ -0,0 +1,441 @@
+package rapport
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/luma/pith/keys"
+	"github.com/luma/pith/rapport/causality"
+)
+
+// tagSet is a set of the unique tags that an ORSet generates for adds
+type tagSet map[causality.Event]bool
+
+// ORSet is a classic Observed-Removed Set. Every add generates a unique tag, a
+// (replica, LamportTime) pair, and removing a value tombstones all of the tags
+// that have been observed for it. A value is in the set while it has at least
+// one tag that has not been tombstoned.
+//
+// Unlike the AWSet the tombstones are kept until they are explicitly discarded
+// using Compact.
+//
+type ORSet struct {
+	Version *causality.VersionVector
+	added   map[string]tagSet
+	removed map[string]tagSet
+	l       sync.RWMutex
+}
+
+// CreateORSet returns a new, empty ORSet.
+//
+func CreateORSet() *ORSet {
+	return &ORSet{
+		Version: causality.CreateVersionVector(),
+		added:   make(map[string]tagSet),
+		removed: make(map[string]tagSet),
+	}
+}
+
+// AddOne adds a single element to the set for a specific replica. It returns
+// true if the element was added, otherwise it returns false.
+//
+func (o *ORSet) AddOne(value string, replica string) bool {
+	tag := causality.Event{
+		Actor: replica,
+		Time:  o.Version.Incr(replica),
+	}
+
+	o.l.Lock()
+	defer o.l.Unlock()
+
+	alreadyExists := o.contains(value)
+
+	tags := o.added[value]
+	if tags == nil {
+		tags = make(tagSet)
+		o.added[value] = tags
+	}
+
+	tags[tag] = true
+
+	return !alreadyExists
+}
+
+// Add adds multiple elements to the set for a specific replica. It returns the
+// number of elements that were added.
+//
+func (o *ORSet) Add(values []string, replica string) int {
+	added := 0
+
+	for _, value := range values {
+		if o.AddOne(value, replica) {
+			added++
+		}
+	}
+
+	return added
+}
+
+// RemoveOne removes a single element from the set by value, tombstoning every
+// tag that has been observed for it. It returns a VersionVector of the tags
+// that were removed, or nil if the element wasn't in the set.
+//
+func (o *ORSet) RemoveOne(value string) *causality.VersionVector {
+	o.l.Lock()
+	defer o.l.Unlock()
+
+	if !o.contains(value) {
+		return nil
+	}
+
+	tombstones := o.removed[value]
+	if tombstones == nil {
+		tombstones = make(tagSet)
+		o.removed[value] = tombstones
+	}
+
+	version := causality.CreateVersionVector()
+	for tag := range o.added[value] {
+		if !tombstones[tag] {
+			tombstones[tag] = true
+			version.Witness(tag.Actor, tag.Time)
+		}
+	}
+
+	return version
+}
+
+// Remove removes a number of values from the set and returns the number
+// of elements that were removed.
+//
+func (o *ORSet) Remove(values []string) int {
+	removed := 0
+
+	for _, value := range values {
+		if o.RemoveOne(value) != nil {
+			removed++
+		}
+	}
+
+	return removed
+}
+
+// Values returns the set elements
+func (o *ORSet) Values() []string {
+	values := make([]string, 0, len(o.added))
+
+	o.Each(func(value string) {
+		values = append(values, value)
+	})
+
+	return values
+}
+
+// Cardinality returns the number of elements in the set
+func (o *ORSet) Cardinality() int {
+	count := 0
+
+	o.Each(func(value string) {
+		count++
+	})
+
+	return count
+}
+
+// IsEmpty returns true if the set contains no elements
+func (o *ORSet) IsEmpty() bool {
+	return o.Cardinality() == 0
+}
+
+// Contains returns true if the value is in the set
+func (o *ORSet) Contains(value string) bool {
+	o.l.RLock()
+	defer o.l.RUnlock()
+
+	return o.contains(value)
+}
+
+// Each iterates over the set calling the provided function at each iteraction
+func (o *ORSet) Each(fn func(string)) {
+	o.l.RLock()
+	defer o.l.RUnlock()
+
+	for value := range o.added {
+		if o.contains(value) {
+			fn(value)
+		}
+	}
+}
+
+// Union returns a new set that is the union between this
+// set and the other
+func (o *ORSet) Union(other Set, replica string) Set {
+	union := CreateORSet()
+	union.Add(o.Values(), replica)
+	union.Add(other.Values(), replica)
+	return union
+}
+
+// Intersect returns a new set that is the intersection between this
+// set and the other
+func (o *ORSet) Intersect(other Set, replica string) Set {
+	intersection := CreateORSet()
+
+	for _, value := range o.Values() {
+		if other.Contains(value) {
+			intersection.AddOne(value, replica)
+		}
+	}
+
+	return intersection
+}
+
+// IsSubsetOf indicates whether this set is a subset of the other
+func (o *ORSet) IsSubsetOf(other Set) bool {
+	for _, value := range o.Values() {
+		if !other.Contains(value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Difference returns a new set that is the difference between this
+// set and the other
+func (o *ORSet) Difference(other Set) []string {
+	diff := make([]string, 0)
+
+	for _, value := range o.Values() {
+		if !other.Contains(value) {
+			diff = append(diff, value)
+		}
+	}
+
+	return diff
+}
+
+// Tombstones returns the number of tombstoned tags that the set is holding
+func (o *ORSet) Tombstones() int {
+	o.l.RLock()
+	defer o.l.RUnlock()
+
+	count := 0
+	for _, tombstones := range o.removed {
+		count += len(tombstones)
+	}
+
+	return count
+}
+
+// Compact discards the tombstones, and the tags they cancel out, for every tag
+// that stable has witnessed. It returns the number of tombstones that were
+// discarded.
+//
+// stable must only witness tags whose removal every replica has already
+// observed, e.g. the pointwise minimum of the Versions of all replicas taken
+// after they have all merged this set. Otherwise a replica that hasn't seen the
+// removal can keep the value alive.
+//
+func (o *ORSet) Compact(stable *causality.VersionVector) int {
+	o.l.Lock()
+	defer o.l.Unlock()
+
+	discarded := 0
+
+	for value, tombstones := range o.removed {
+		for tag := range tombstones {
+			if !stable.Includes(tag) {
+				continue
+			}
+
+			delete(tombstones, tag)
+			delete(o.added[value], tag)
+			discarded++
+		}
+
+		if len(tombstones) == 0 {
+			delete(o.removed, value)
+		}
+
+		if len(o.added[value]) == 0 {
+			delete(o.added, value)
+		}
+	}
+
+	return discarded
+}
+
+// Merge another ORSet into this one
+//
+func (o *ORSet) Merge(crdt CRDT) {
+	other := crdt.(*ORSet)
+
+	o.l.Lock()
+	other.l.RLock()
+
+	defer func() {
+		o.l.Unlock()
+		other.l.RUnlock()
+	}()
+
+	for value, otherTombstones := range other.removed {
+		tombstones := o.removed[value]
+		if tombstones == nil {
+			tombstones = make(tagSet)
+			o.removed[value] = tombstones
+		}
+
+		for tag := range otherTombstones {
+			if !tombstones[tag] && !o.added[value][tag] && o.Version.Includes(tag) {
+				// We've witnessed this tag before but hold neither it or it's
+				// tombstone, so it must have been removed and compacted away.
+				continue
+			}
+
+			tombstones[tag] = true
+		}
+
+		if len(tombstones) == 0 {
+			delete(o.removed, value)
+		}
+	}
+
+	for value, otherTags := range other.added {
+		tags := o.added[value]
+		if tags == nil {
+			tags = make(tagSet)
+		}
+
+		for tag := range otherTags {
+			if !tags[tag] && !o.removed[value][tag] && o.Version.Includes(tag) {
+				// We've witnessed this tag before but hold neither it or it's
+				// tombstone, so it must have been removed and compacted away.
+				continue
+			}
+
+			tags[tag] = true
+		}
+
+		if len(tags) > 0 {
+			o.added[value] = tags
+		}
+	}
+
+	o.Version.Merge(other.Version)
+}
+
+// Marshal serialises the set data to bytes
+func (o *ORSet) Marshal() ([]*Segment, error) {
+	o.l.RLock()
+	defer o.l.RUnlock()
+
+	segments := make([]*Segment, 0, 1+len(o.added))
+
+	v, err := o.Version.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	segments = append(segments, &Segment{
+		Value: v,
+	})
+
+	for value, tags := range o.added {
+		entry := &ORTags{
+			Added:   marshalTags(tags),
+			Removed: marshalTags(o.removed[value]),
+		}
+
+		b, err := entry.Marshal()
+		if err != nil {
+			return nil, err
+		}
+
+		segments = append(segments, &Segment{
+			KeySuffix: keys.Make(EntriesKey, []byte(value)),
+			Value:     b,
+		})
+	}
+
+	return segments, nil
+}
+
+// Unmarshal deserialises the set data from bytes
+func (o *ORSet) Unmarshal(data []*Segment) error {
+	version, err := causality.UnmarshalVersionVector(data[0].Value)
+	if err != nil {
+		return err
+	}
+
+	added := make(map[string]tagSet)
+	removed := make(map[string]tagSet)
+
+	for _, s := range data[1:] {
+		if s.KeySuffix[0] != EntriesKey[0] {
+			return fmt.Errorf("Unexpected key suffix for set: %s", s.KeySuffix)
+		}
+
+		entry := &ORTags{}
+		if err := entry.Unmarshal(s.Value); err != nil {
+			return err
+		}
+
+		// Strip off the key sigil and add the entry
+		value := string(s.KeySuffix[2:])
+		added[value] = unmarshalTags(entry.Added)
+
+		if len(entry.Removed) > 0 {
+			removed[value] = unmarshalTags(entry.Removed)
+		}
+	}
+
+	o.l.Lock()
+	o.Version = version
+	o.added = added
+	o.removed = removed
+	o.l.Unlock()
+
+	return nil
+}
+
+// contains returns true if the value has any tags that haven't been
+// tombstoned
+//
+// This method is not thread safe
+//
+func (o *ORSet) contains(value string) bool {
+	tombstones := o.removed[value]
+
+	for tag := range o.added[value] {
+		if !tombstones[tag] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func marshalTags(tags tagSet) []*ORTag {
+	values := make([]*ORTag, 0, len(tags))
+	for tag := range tags {
+		values = append(values, &ORTag{
+			Replica: tag.Actor,
+			Time:    uint64(tag.Time),
+		})
+	}
+
+	return values
+}
+
+func unmarshalTags(values []*ORTag) tagSet {
+	tags := make(tagSet)
+	for _, value := range values {
+		tags[causality.Event{
+			Actor: value.Replica,
+			Time:  causality.LamportTime(value.Time),
+		}] = true
+	}
+
+	return tags
+}
@@ -0,0 +1,156 @@
+package rapport_test
+
+import (
+	"sort"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/luma/pith/rapport"
+	"github.com/luma/pith/rapport/causality"
+)
+
+var _ = Describe("ORSet", func() {
+	var set *ORSet
+
+	JustBeforeEach(func() {
+		set = CreateORSet()
+		set.AddOne("foo", "replica1")
+	})
+
+	It("satisfies the Set contract", func() {
+		var s Set = set
+		Expect(s.Contains("foo")).To(BeTrue())
+	})
+
+	Describe("AddOne()", func() {
+		It("increments the version vector", func() {
+			t, exists := set.Version.Get("replica1")
+			Expect(t).To(Equal(causality.LamportTime(1)))
+			Expect(exists).To(BeTrue())
+		})
+
+		It("returns false when the value is already in the set", func() {
+			Expect(set.AddOne("foo", "replica1")).To(BeFalse())
+		})
+
+		It("can re-add a removed value", func() {
+			set.RemoveOne("foo")
+			Expect(set.AddOne("foo", "replica1")).To(BeTrue())
+			Expect(set.Contains("foo")).To(BeTrue())
+		})
+	})
+
+	Describe("RemoveOne()", func() {
+		It("removes the value and tombstones it's tags", func() {
+			removed := set.RemoveOne("foo")
+			Expect(removed).ToNot(BeNil())
+			Expect(removed.Includes(causality.Event{Actor: "replica1", Time: 1})).To(BeTrue())
+
+			Expect(set.Contains("foo")).To(BeFalse())
+			Expect(set.Tombstones()).To(Equal(1))
+		})
+
+		It("returns nil when the value is not in the set", func() {
+			Expect(set.RemoveOne("wut")).To(BeNil())
+		})
+	})
+
+	Describe("Merge()", func() {
+		It("keeps concurrent adds that the remove did not observe", func() {
+			set2 := CreateORSet()
+			set2.Merge(set)
+
+			set2.RemoveOne("foo")
+			set.AddOne("foo", "replica1")
+
+			set.Merge(set2)
+			set2.Merge(set)
+
+			Expect(set.Contains("foo")).To(BeTrue())
+			Expect(set2.Contains("foo")).To(BeTrue())
+		})
+
+		It("propagates removes", func() {
+			set2 := CreateORSet()
+			set2.Merge(set)
+			set2.AddOne("bar", "replica2")
+			set2.RemoveOne("foo")
+
+			set.Merge(set2)
+
+			Expect(set.Values()).To(Equal([]string{"bar"}))
+		})
+	})
+
+	Describe("Compact()", func() {
+		var set2 *ORSet
+
+		JustBeforeEach(func() {
+			set2 = CreateORSet()
+			set2.Merge(set)
+			set.RemoveOne("foo")
+			set2.Merge(set)
+		})
+
+		It("discards tombstones that the stable version has witnessed", func() {
+			Expect(set.Compact(set.Version.Clone())).To(Equal(1))
+			Expect(set.Tombstones()).To(Equal(0))
+			Expect(set.Contains("foo")).To(BeFalse())
+		})
+
+		It("keeps tombstones that the stable version has not witnessed", func() {
+			Expect(set.Compact(causality.CreateVersionVector())).To(Equal(0))
+			Expect(set.Tombstones()).To(Equal(1))
+		})
+
+		It("does not resurrect compacted values when merging", func() {
+			set.Compact(set.Version.Clone())
+
+			set.Merge(set2)
+
+			Expect(set.Contains("foo")).To(BeFalse())
+		})
+
+		It("does not bring back compacted tombstones when merging", func() {
+			set.Compact(set.Version.Clone())
+
+			set.Merge(set2)
+			Expect(set.Tombstones()).To(Equal(0))
+
+			set2.Compact(set2.Version.Clone())
+			set2.Merge(set)
+			Expect(set2.Tombstones()).To(Equal(0))
+		})
+
+		It("merges tombstones that it hasn't witnessed yet", func() {
+			set.Compact(set.Version.Clone())
+
+			set3 := CreateORSet()
+			set3.Merge(set2)
+			Expect(set3.Tombstones()).To(Equal(1))
+			Expect(set3.Contains("foo")).To(BeFalse())
+		})
+	})
+
+	Describe("Marshal()", func() {
+		It("round trips through Unmarshal()", func() {
+			set.Add([]string{"bar", "baz"}, "replica1")
+			set.RemoveOne("bar")
+
+			segments, err := set.Marshal()
+			Expect(err).ToNot(HaveOccurred())
+
+			set2 := CreateORSet()
+			Expect(set2.Unmarshal(segments)).To(Succeed())
+
+			values := set2.Values()
+			sort.Strings(values)
+			Expect(values).To(Equal([]string{"baz", "foo"}))
+			Expect(set2.Tombstones()).To(Equal(1))
+
+			t, _ := set2.Version.Get("replica1")
+			Expect(t).To(Equal(causality.LamportTime(3)))
+		})
+	})
+})
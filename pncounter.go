@@ -67,15 +67,7 @@ func (p *PNCounter) Merge(crdt CRDT) {
 		other.l.Unlock()
 	}()
 
-	for id, incVal := range other.value.Inc {
-		if localInc, exists := p.value.Inc[id]; !exists || localInc < incVal {
-			p.value.Inc[id] = incVal
-		}
-
-		if localDec, exists := p.value.Dec[id]; !exists || localDec < other.value.Dec[id] {
-			p.value.Dec[id] = other.value.Dec[id]
-		}
-	}
+	mergePNCounterValues(p.value, other.value)
 }
 
 // Marshal serialises the counter data to bytes
@@ -99,3 +91,19 @@ func (p *PNCounter) Unmarshal(data []*Segment) error {
 
 	return p.value.Unmarshal(data[0].Value)
 }
+
+// mergePNCounterValues merges src into dst by taking the maximum increments
+// and decrements for each replica
+func mergePNCounterValues(dst *marshalling.PNCounterValue, src *marshalling.PNCounterValue) {
+	for id, incVal := range src.Inc {
+		if localInc, exists := dst.Inc[id]; !exists || localInc < incVal {
+			dst.Inc[id] = incVal
+		}
+	}
+
+	for id, decVal := range src.Dec {
+		if localDec, exists := dst.Dec[id]; !exists || localDec < decVal {
+			dst.Dec[id] = decVal
+		}
+	}
+}
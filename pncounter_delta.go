@@ -0,0 +1,133 @@
+package rapport
+
+import (
+	"sync"
+
+	"github.com/luma/pith/rapport/marshalling"
+)
+
+// PNCounterDelta is a delta, or a delta-group, for a PNCounter. It contains
+// only the increments and decrements of the replicas that have mutated the
+// counter since the delta was created, so it can be replicated far more
+// cheaply than the whole counter.
+//
+// Deltas are joined using Merge and applied to a PNCounter with MergeDelta.
+// As the join takes the maximum for each replica, deltas can be applied more
+// than once and in any order.
+//
+type PNCounterDelta struct {
+	value *marshalling.PNCounterValue
+	l     sync.RWMutex
+}
+
+// CreatePNCounterDelta returns a new, empty, PNCounterDelta.
+//
+func CreatePNCounterDelta() *PNCounterDelta {
+	return &PNCounterDelta{
+		value: &marshalling.PNCounterValue{
+			Inc: make(map[string]int64),
+			Dec: make(map[string]int64),
+		},
+	}
+}
+
+// IsEmpty returns true if the delta does not contain any replicas
+func (d *PNCounterDelta) IsEmpty() bool {
+	d.l.RLock()
+	defer d.l.RUnlock()
+
+	return len(d.value.Inc) == 0 && len(d.value.Dec) == 0
+}
+
+// Merge joins another PNCounterDelta into this one
+//
+func (d *PNCounterDelta) Merge(crdt CRDT) {
+	other := crdt.(*PNCounterDelta)
+
+	d.l.Lock()
+	other.l.RLock()
+
+	defer func() {
+		d.l.Unlock()
+		other.l.RUnlock()
+	}()
+
+	mergePNCounterValues(d.value, other.value)
+}
+
+// Marshal serialises the delta data to bytes
+func (d *PNCounterDelta) Marshal() ([]*Segment, error) {
+	d.l.RLock()
+	v, err := d.value.Marshal()
+	d.l.RUnlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	segment := &Segment{
+		Value: v,
+	}
+	return []*Segment{segment}, nil
+}
+
+// Unmarshal deserialises the delta data from bytes
+func (d *PNCounterDelta) Unmarshal(data []*Segment) error {
+	value := CreatePNCounterDelta().value
+	if err := value.Unmarshal(data[0].Value); err != nil {
+		return err
+	}
+
+	d.l.Lock()
+	d.value = value
+	d.l.Unlock()
+
+	return nil
+}
+
+// IncrByDelta increments the counter by amount, like IncrBy, and returns a
+// delta that contains only this replica's counts.
+//
+func (p *PNCounter) IncrByDelta(amount int64) *PNCounterDelta {
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	p.value.IncrBy(p.replicaId, amount)
+	return p.delta()
+}
+
+// DecrByDelta decrements the counter by amount, like DecrBy, and returns a
+// delta that contains only this replica's counts.
+//
+func (p *PNCounter) DecrByDelta(amount int64) *PNCounterDelta {
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	p.value.IncrBy(p.replicaId, -amount)
+	return p.delta()
+}
+
+// MergeDelta joins a delta, or a delta-group, into this counter
+//
+func (p *PNCounter) MergeDelta(delta *PNCounterDelta) {
+	p.l.Lock()
+	delta.l.RLock()
+
+	defer func() {
+		p.l.Unlock()
+		delta.l.RUnlock()
+	}()
+
+	mergePNCounterValues(p.value, delta.value)
+}
+
+// delta returns a PNCounterDelta containing this replica's counts
+//
+// This method is not thread safe
+//
+func (p *PNCounter) delta() *PNCounterDelta {
+	delta := CreatePNCounterDelta()
+	delta.value.Inc[p.replicaId] = p.value.Inc[p.replicaId]
+	delta.value.Dec[p.replicaId] = p.value.Dec[p.replicaId]
+	return delta
+}
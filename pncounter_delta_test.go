@@ -0,0 +1,76 @@
+package rapport_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/luma/pith/rapport"
+)
+
+var _ = Describe("PNCounterDelta", func() {
+	var counter1, counter2 *PNCounter
+
+	JustBeforeEach(func() {
+		counter1 = CreatePNCounter("replica1")
+		counter2 = CreatePNCounter("replica2")
+	})
+
+	It("IncrByDelta() increments the counter", func() {
+		counter1.IncrByDelta(5)
+		Expect(counter1.Value()).To(Equal(int64(5)))
+	})
+
+	It("DecrByDelta() decrements the counter", func() {
+		counter1.DecrByDelta(5)
+		Expect(counter1.Value()).To(Equal(int64(-5)))
+	})
+
+	It("applies deltas to another counter", func() {
+		counter2.IncrBy(2)
+		counter2.MergeDelta(counter1.IncrByDelta(5))
+		counter2.MergeDelta(counter1.DecrByDelta(1))
+
+		Expect(counter2.Value()).To(Equal(int64(6)))
+	})
+
+	It("is idempotent", func() {
+		delta := counter1.IncrByDelta(5)
+		counter2.MergeDelta(delta)
+		counter2.MergeDelta(delta)
+
+		Expect(counter2.Value()).To(Equal(int64(5)))
+	})
+
+	It("ignores deltas that are older than the state", func() {
+		old := counter1.IncrByDelta(5)
+		counter2.MergeDelta(counter1.IncrByDelta(5))
+		counter2.MergeDelta(old)
+
+		Expect(counter2.Value()).To(Equal(int64(10)))
+	})
+
+	It("accumulates deltas into a delta-group", func() {
+		group := CreatePNCounterDelta()
+		Expect(group.IsEmpty()).To(BeTrue())
+
+		group.Merge(counter1.IncrByDelta(5))
+		group.Merge(counter1.DecrByDelta(2))
+		group.Merge(counter2.IncrByDelta(3))
+
+		counter3 := CreatePNCounter("replica3")
+		counter3.MergeDelta(group)
+
+		Expect(counter3.Value()).To(Equal(int64(6)))
+	})
+
+	It("round trips through Marshal() and Unmarshal()", func() {
+		segments, err := counter1.IncrByDelta(5).Marshal()
+		Expect(err).ToNot(HaveOccurred())
+
+		delta := CreatePNCounterDelta()
+		Expect(delta.Unmarshal(segments)).To(Succeed())
+
+		counter2.MergeDelta(delta)
+		Expect(counter2.Value()).To(Equal(int64(5)))
+	})
+})
@@ -26,17 +26,28 @@ type Value interface {
 	Marshaler
 }
 
-// SetOperations encapsulates the common set operations
-type SetOperations interface {
-	Contains(value string) bool
+// Resetter is implemented by Values that can be reset to their initial state
+// without losing convergence. A reset only affects the updates that it has
+// observed, updates that are concurrent with it survive a merge.
+//
+type Resetter interface {
+	Reset()
+}
+
+// SetOperationsOf encapsulates the common set operations
+type SetOperationsOf[T comparable] interface {
+	Contains(value T) bool
 	Cardinality() int
-	Difference(other Set) []string
-	Union(other Set, replica string) Set
-	Intersect(other Set, replica string) Set
-	IsSubsetOf(other Set) bool
+	Difference(other SetOf[T]) []T
+	Union(other SetOf[T], replica string) SetOf[T]
+	Intersect(other SetOf[T], replica string) SetOf[T]
+	IsSubsetOf(other SetOf[T]) bool
 	IsEmpty() bool
 }
 
+// SetOperations are the SetOperationsOf strings
+type SetOperations = SetOperationsOf[string]
+
 type Register interface {
 	CRDT
 	Marshaler
@@ -45,19 +56,34 @@ type Register interface {
 	Get() string
 }
 
-// Set is the contract that all Pith sets must abide by
-type Set interface {
+// SetOf is the contract that all Pith sets must abide by
+type SetOf[T comparable] interface {
 	CRDT
 	Marshaler
-	SetOperations
+	SetOperationsOf[T]
 
-	Add(values []string, replica string) int
-	AddOne(value string, replica string) bool
-	Remove(values []string) int
-	RemoveOne(value string) *causality.VersionVector
+	Add(values []T, replica string) int
+	AddOne(value T, replica string) bool
+	Remove(values []T) int
+	RemoveOne(value T) *causality.VersionVector
 
-	Values() []string
-	Each(fn func(string))
+	Values() []T
+	Each(fn func(T))
+}
+
+// Set is a SetOf strings, all of the Pith sets support it
+type Set = SetOf[string]
+
+// GrowOnlyCounter is the contract that all Pith counters that can only
+// increase must abide by
+type GrowOnlyCounter interface {
+	CRDT
+	Marshaler
+
+	Incr() int64
+	IncrBy(amount int64) int64
+
+	Value() int64
 }
 
 // Counter is the contract that all Pith counters must abide by
@@ -72,3 +98,15 @@ type Counter interface {
 
 	Value() int64
 }
+
+// Sequence is the contract that all Pith sequences must abide by
+type Sequence interface {
+	CRDT
+	Marshaler
+
+	Insert(index int, value string, replica string) error
+	Delete(index int) error
+
+	Len() int
+	Values() []string
+}
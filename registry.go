@@ -0,0 +1,189 @@
+package rapport
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/luma/pith/keys"
+	"github.com/luma/pith/rapport/marshalling"
+)
+
+var (
+	// EnvelopeKey is the sigil used to deliminate a key that is for the
+	// segments of a value wrapped in an envelope, see MarshalValue
+	EnvelopeKey = []byte("V")
+)
+
+// ValueConstructor returns a new, empty, Value
+type ValueConstructor func() Value
+
+type typeRegistry struct {
+	constructors map[marshalling.ValueType]ValueConstructor
+	types        map[reflect.Type]marshalling.ValueType
+	l            sync.RWMutex
+}
+
+var registry = &typeRegistry{
+	constructors: make(map[marshalling.ValueType]ValueConstructor),
+	types:        make(map[reflect.Type]marshalling.ValueType),
+}
+
+func init() {
+	mustRegisterType(marshalling.ValueType_Register, func() Value { return &LWWRegister{} })
+	mustRegisterType(marshalling.ValueType_Counter, func() Value { return CreatePNCounter("") })
+	mustRegisterType(marshalling.ValueType_Set, func() Value { return CreateAWSet() })
+	mustRegisterType(marshalling.ValueType_Flag, func() Value { return CreateEWFlag() })
+	mustRegisterType(marshalling.ValueType_Sequence, func() Value { return CreateRGA() })
+	mustRegisterType(marshalling.ValueType_Map, func() Value { return CreateAWMap() })
+	mustRegisterType(marshalling.ValueType_GCounter, func() Value { return CreateGCounter("") })
+	mustRegisterType(marshalling.ValueType_GSet, func() Value { return CreateGSet() })
+	mustRegisterType(marshalling.ValueType_TwoPhaseSet, func() Value { return CreateTwoPhaseSet() })
+	mustRegisterType(marshalling.ValueType_LWWElementSet, func() Value { return CreateLWWElementSet(BiasAdd) })
+	mustRegisterType(marshalling.ValueType_ORSet, func() Value { return CreateORSet() })
+	mustRegisterType(marshalling.ValueType_MVRegister, func() Value { return CreateMVRegister() })
+	mustRegisterType(marshalling.ValueType_DWFlag, func() Value { return CreateDWFlag() })
+	mustRegisterType(marshalling.ValueType_BoundedCounter, func() Value { return CreateBoundedCounter("", 0) })
+	mustRegisterType(marshalling.ValueType_ResettableCounter, func() Value { return CreateResettableCounter("") })
+}
+
+// mustRegisterType is like RegisterType but panics if the type can't be
+// registered. It registers the built-in types, so a failure means that two of
+// them clash.
+//
+func mustRegisterType(valueType marshalling.ValueType, create ValueConstructor) {
+	if err := RegisterType(valueType, create); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterType associates a ValueType with the Go type of the Values that
+// create returns. Each ValueType, and each Go type, can only be registered
+// once.
+//
+func RegisterType(valueType marshalling.ValueType, create ValueConstructor) error {
+	goType := reflect.TypeOf(create())
+
+	registry.l.Lock()
+	defer registry.l.Unlock()
+
+	if _, exists := registry.constructors[valueType]; exists {
+		return fmt.Errorf("ValueType %v has already been registered", valueType)
+	}
+
+	if existing, exists := registry.types[goType]; exists {
+		return fmt.Errorf("%v has already been registered as ValueType %v", goType, existing)
+	}
+
+	registry.constructors[valueType] = create
+	registry.types[goType] = valueType
+	return nil
+}
+
+// TypeOf returns the ValueType that value's Go type is registered as
+func TypeOf(value Value) (marshalling.ValueType, error) {
+	registry.l.RLock()
+	valueType, exists := registry.types[reflect.TypeOf(value)]
+	registry.l.RUnlock()
+
+	if !exists {
+		return 0, fmt.Errorf("Unregistered value type: %T", value)
+	}
+
+	return valueType, nil
+}
+
+// CreateValue returns a new, empty, Value of a registered ValueType
+func CreateValue(valueType marshalling.ValueType) (Value, error) {
+	registry.l.RLock()
+	create, exists := registry.constructors[valueType]
+	registry.l.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("Unregistered ValueType: %v", valueType)
+	}
+
+	return create(), nil
+}
+
+// BindReplica sets the replica that mutates value, for Values, like the
+// counters, that are created for a specific replica. Values that Unmarshal
+// creates aren't bound to any replica. It does nothing for other Values.
+//
+func BindReplica(value Value, replica string) {
+	if binder, ok := value.(replicaBinder); ok {
+		binder.bindReplica(replica)
+	}
+}
+
+// MarshalValue serialises value inside of an envelope that records its
+// ValueType, so that it can be unmarshalled with Unmarshal without knowing
+// its type ahead of time.
+//
+// The envelope is a header segment containing the ValueType. The value's own
+// segments are nested under EnvelopeKey so that they still sort after it.
+//
+func MarshalValue(value Value) ([]*Segment, error) {
+	valueType, err := TypeOf(value)
+	if err != nil {
+		return nil, err
+	}
+
+	valueSegments, err := value.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]*Segment, 0, 1+len(valueSegments))
+	segments = append(segments, &Segment{
+		Value: binary.AppendUvarint(nil, uint64(valueType)),
+	})
+
+	for _, s := range valueSegments {
+		segments = append(segments, &Segment{
+			KeySuffix: keys.Make(EnvelopeKey, s.KeySuffix),
+			Value:     s.Value,
+		})
+	}
+
+	return segments, nil
+}
+
+// Unmarshal deserialises segments produced by MarshalValue and returns a
+// Value of the right concrete type.
+//
+func Unmarshal(data []*Segment) (Value, error) {
+	if len(data) == 0 || len(data[0].KeySuffix) != 0 {
+		return nil, fmt.Errorf("Value data does not start with an envelope")
+	}
+
+	valueType, n := binary.Uvarint(data[0].Value)
+	if n <= 0 {
+		return nil, fmt.Errorf("Malformed value envelope")
+	}
+
+	value, err := CreateValue(marshalling.ValueType(valueType))
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]*Segment, 0, len(data)-1)
+	for _, s := range data[1:] {
+		if len(s.KeySuffix) < 2 || s.KeySuffix[0] != EnvelopeKey[0] {
+			return nil, fmt.Errorf("Unexpected key suffix for value envelope: %s", s.KeySuffix)
+		}
+
+		// Strip off the key sigil to get the value's key suffix
+		segments = append(segments, &Segment{
+			KeySuffix: s.KeySuffix[2:],
+			Value:     s.Value,
+		})
+	}
+
+	if err := value.Unmarshal(segments); err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
@@ -0,0 +1,89 @@
+package rapport_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/luma/pith/rapport"
+	"github.com/luma/pith/rapport/marshalling"
+)
+
+// unregisteredValue is a Value whose type has not been registered
+type unregisteredValue struct {
+	*AWSet
+}
+
+var _ = Describe("Registry", func() {
+	Describe("TypeOf()", func() {
+		It("returns the registered ValueType", func() {
+			valueType, err := TypeOf(CreateGCounter("a"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(valueType).To(Equal(marshalling.ValueType_GCounter))
+
+			valueType, err = TypeOf(CreateAWSet())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(valueType).To(Equal(marshalling.ValueType_Set))
+		})
+
+		It("returns an error for unregistered types", func() {
+			_, err := TypeOf(unregisteredValue{CreateAWSet()})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("RegisterType()", func() {
+		It("rejects ValueTypes that are already registered", func() {
+			err := RegisterType(marshalling.ValueType_Set, func() Value {
+				return unregisteredValue{CreateAWSet()}
+			})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Unmarshal()", func() {
+		It("returns the right concrete type", func() {
+			counter := CreatePNCounter("a")
+			counter.IncrBy(3)
+
+			set := CreateAWSet()
+			set.Add([]string{"foo", "bar"}, "a")
+
+			segments, err := MarshalValue(counter)
+			Expect(err).ToNot(HaveOccurred())
+
+			value, err := Unmarshal(segments)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(BeAssignableToTypeOf(&PNCounter{}))
+			Expect(value.(*PNCounter).Value()).To(Equal(int64(3)))
+
+			segments, err = MarshalValue(set)
+			Expect(err).ToNot(HaveOccurred())
+
+			value, err = Unmarshal(segments)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value.(*AWSet).Values()).To(ConsistOf("foo", "bar"))
+		})
+
+		It("returns values that can be bound to a replica", func() {
+			segments, err := MarshalValue(CreateGCounter("a"))
+			Expect(err).ToNot(HaveOccurred())
+
+			value, err := Unmarshal(segments)
+			Expect(err).ToNot(HaveOccurred())
+
+			BindReplica(value, "b")
+			Expect(value.(*GCounter).Incr()).To(Equal(int64(1)))
+		})
+
+		It("rejects segments without an envelope", func() {
+			set := CreateGSet()
+			set.AddOne("foo")
+
+			segments, err := set.Marshal()
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = Unmarshal(segments)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
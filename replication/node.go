@@ -0,0 +1,572 @@
+package replication
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/luma/pith/rapport"
+	"github.com/luma/pith/rapport/causality"
+)
+
+// ValueFactory returns a new, empty, Value. It's used to create the values
+// that a Node replicates, and the scratch values that changes from peers are
+// unmarshalled into before they are merged.
+//
+type ValueFactory func() rapport.Value
+
+// Node is a replica that holds a collection of named Values and keeps them in
+// sync with its peers.
+//
+// Every change to a value's segments is recorded as an event in a per value
+// VersionVector, so that when two Nodes sync they only need to exchange their
+// VersionVectors to work out which segments the other is missing.
+//
+// Only values that have been registered, under the same name, on both Nodes
+// are synced.
+//
+type Node struct {
+	replica   string
+	transport Transport
+
+	values map[string]*replicatedValue
+	peers  map[string]struct{}
+
+	onError func(peer string, err error)
+	stop    chan struct{}
+	wg      sync.WaitGroup
+
+	l sync.RWMutex
+}
+
+// replicatedValue is a Value along with what we know of the changes to it
+type replicatedValue struct {
+	value   rapport.Value
+	factory ValueFactory
+	version *causality.VersionVector
+
+	// segments are the last known segments of the value, keyed by key
+	// suffix. Segments that have been deleted are kept as tombstones so
+	// that the deletion can be shipped to peers.
+	segments map[string]*trackedSegment
+}
+
+// trackedSegment is a segment and the event that last changed it
+type trackedSegment struct {
+	value   []byte
+	event   causality.Event
+	deleted bool
+}
+
+// CreateNode returns a new Node, with no values, that replicates over the
+// transport.
+//
+func CreateNode(replica string, transport Transport) *Node {
+	n := &Node{
+		replica:   replica,
+		transport: transport,
+		values:    make(map[string]*replicatedValue),
+		peers:     make(map[string]struct{}),
+	}
+
+	transport.Handle(n.handle)
+	return n
+}
+
+// Replica returns the replica id of this node
+func (n *Node) Replica() string {
+	return n.replica
+}
+
+// Register adds a value, created by the factory, that will be replicated
+// under name.
+//
+func (n *Node) Register(name string, factory ValueFactory) error {
+	n.l.Lock()
+	defer n.l.Unlock()
+
+	if _, exists := n.values[name]; exists {
+		return fmt.Errorf("A value called %s has already been registered", name)
+	}
+
+	rv := &replicatedValue{
+		value:    factory(),
+		factory:  factory,
+		version:  causality.CreateVersionVector(),
+		segments: make(map[string]*trackedSegment),
+	}
+
+	if err := rv.snapshot(n.replica, nil); err != nil {
+		return err
+	}
+
+	n.values[name] = rv
+	return nil
+}
+
+// Names returns the names of all registered values, sorted
+func (n *Node) Names() []string {
+	n.l.RLock()
+	names := make([]string, 0, len(n.values))
+	for name := range n.values {
+		names = append(names, name)
+	}
+	n.l.RUnlock()
+
+	sort.Strings(names)
+	return names
+}
+
+// Update calls fn with the named value so that it can be changed. All local
+// changes must be made through Update, otherwise they won't be replicated.
+//
+func (n *Node) Update(name string, fn func(value rapport.Value) error) error {
+	n.l.Lock()
+	defer n.l.Unlock()
+
+	rv, exists := n.values[name]
+	if !exists {
+		return fmt.Errorf("No value called %s has been registered", name)
+	}
+
+	if err := fn(rv.value); err != nil {
+		return err
+	}
+
+	return rv.snapshot(n.replica, nil)
+}
+
+// View calls fn with the named value so that it can be read. The value must
+// not be changed.
+//
+func (n *Node) View(name string, fn func(value rapport.Value) error) error {
+	n.l.RLock()
+	defer n.l.RUnlock()
+
+	rv, exists := n.values[name]
+	if !exists {
+		return fmt.Errorf("No value called %s has been registered", name)
+	}
+
+	return fn(rv.value)
+}
+
+// Version returns a copy of the VersionVector for the named value
+func (n *Node) Version(name string) (*causality.VersionVector, error) {
+	n.l.RLock()
+	defer n.l.RUnlock()
+
+	rv, exists := n.values[name]
+	if !exists {
+		return nil, fmt.Errorf("No value called %s has been registered", name)
+	}
+
+	return rv.version.Clone(), nil
+}
+
+// AddPeer adds a peer to sync with when running anti-entropy
+func (n *Node) AddPeer(peer string) {
+	n.l.Lock()
+	n.peers[peer] = struct{}{}
+	n.l.Unlock()
+}
+
+// RemovePeer stops syncing with a peer when running anti-entropy
+func (n *Node) RemovePeer(peer string) {
+	n.l.Lock()
+	delete(n.peers, peer)
+	n.l.Unlock()
+}
+
+// OnSyncError sets a function that is called when syncing with a peer fails
+// during anti-entropy.
+//
+func (n *Node) OnSyncError(fn func(peer string, err error)) {
+	n.l.Lock()
+	n.onError = fn
+	n.l.Unlock()
+}
+
+// Start runs anti-entropy in the background, syncing with a random peer every
+// interval.
+//
+func (n *Node) Start(interval time.Duration) {
+	n.l.Lock()
+	defer n.l.Unlock()
+
+	if n.stop != nil {
+		return
+	}
+
+	n.stop = make(chan struct{})
+	n.wg.Add(1)
+	go n.run(interval, n.stop)
+}
+
+// Stop stops anti-entropy, it waits for any sync that is in progress
+func (n *Node) Stop() {
+	n.l.Lock()
+	stop := n.stop
+	n.stop = nil
+	n.l.Unlock()
+
+	if stop == nil {
+		return
+	}
+
+	close(stop)
+	n.wg.Wait()
+}
+
+func (n *Node) run(interval time.Duration, stop chan struct{}) {
+	defer n.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+
+		case <-ticker.C:
+			peer, ok := n.randomPeer()
+			if !ok {
+				continue
+			}
+
+			if err := n.SyncWith(peer); err != nil {
+				n.l.RLock()
+				onError := n.onError
+				n.l.RUnlock()
+
+				if onError != nil {
+					onError(peer, err)
+				}
+			}
+		}
+	}
+}
+
+func (n *Node) randomPeer() (string, bool) {
+	n.l.RLock()
+	defer n.l.RUnlock()
+
+	if len(n.peers) == 0 {
+		return "", false
+	}
+
+	i := rand.Intn(len(n.peers))
+	for peer := range n.peers {
+		if i == 0 {
+			return peer, true
+		}
+		i--
+	}
+
+	return "", false
+}
+
+// SyncWith runs a single round of push-pull anti-entropy with a peer. Our
+// digest is sent to the peer, who replies with the segments we are missing
+// and their own digest. Then we send the peer the segments they are missing.
+//
+func (n *Node) SyncWith(peer string) error {
+	digests, err := n.digests()
+	if err != nil {
+		return err
+	}
+
+	reply, err := n.transport.Call(peer, &Message{
+		Type:    MessageType_Digest,
+		From:    n.replica,
+		Digests: digests,
+	})
+	if err != nil {
+		return err
+	}
+
+	if reply.Type != MessageType_Changes {
+		return fmt.Errorf("Expected changes from %s, but got %v", peer, reply.Type)
+	}
+
+	if err := n.apply(reply.Changes); err != nil {
+		return err
+	}
+
+	changes, err := n.changes(reply.Digests)
+	if err != nil {
+		return err
+	}
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	reply, err = n.transport.Call(peer, &Message{
+		Type:    MessageType_Changes,
+		From:    n.replica,
+		Changes: changes,
+	})
+	if err != nil {
+		return err
+	}
+
+	if reply.Type != MessageType_Ack {
+		return fmt.Errorf("Expected an ack from %s, but got %v", peer, reply.Type)
+	}
+
+	return nil
+}
+
+// Close stops anti-entropy and closes the transport
+func (n *Node) Close() error {
+	n.Stop()
+	return n.transport.Close()
+}
+
+func (n *Node) handle(msg *Message) (*Message, error) {
+	switch msg.Type {
+	case MessageType_Digest:
+		changes, err := n.changes(msg.Digests)
+		if err != nil {
+			return nil, err
+		}
+
+		digests, err := n.digests()
+		if err != nil {
+			return nil, err
+		}
+
+		return &Message{
+			Type:    MessageType_Changes,
+			From:    n.replica,
+			Digests: digests,
+			Changes: changes,
+		}, nil
+
+	case MessageType_Changes:
+		if err := n.apply(msg.Changes); err != nil {
+			return nil, err
+		}
+
+		return &Message{Type: MessageType_Ack, From: n.replica}, nil
+
+	default:
+		return nil, fmt.Errorf("Unexpected message type: %v", msg.Type)
+	}
+}
+
+// digests returns the VersionVector of every value
+func (n *Node) digests() ([]*ValueDigest, error) {
+	n.l.RLock()
+	defer n.l.RUnlock()
+
+	digests := make([]*ValueDigest, 0, len(n.values))
+	for name, rv := range n.values {
+		version, err := rv.version.Marshal()
+		if err != nil {
+			return nil, err
+		}
+
+		digests = append(digests, &ValueDigest{Name: name, Version: version})
+	}
+
+	return digests, nil
+}
+
+// changes returns the segments that a peer is missing, for each of the values
+// in their digests.
+//
+func (n *Node) changes(digests []*ValueDigest) ([]*ValueChanges, error) {
+	n.l.RLock()
+	defer n.l.RUnlock()
+
+	changes := make([]*ValueChanges, 0, len(digests))
+	for _, digest := range digests {
+		rv, exists := n.values[digest.Name]
+		if !exists {
+			continue
+		}
+
+		peerVersion, err := causality.UnmarshalVersionVector(digest.Version)
+		if err != nil {
+			return nil, err
+		}
+
+		segments := rv.missingFrom(peerVersion)
+		if len(segments) == 0 {
+			continue
+		}
+
+		version, err := rv.version.Marshal()
+		if err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, &ValueChanges{
+			Name:     digest.Name,
+			Version:  version,
+			Segments: segments,
+		})
+	}
+
+	return changes, nil
+}
+
+// apply merges changes from a peer
+func (n *Node) apply(changes []*ValueChanges) error {
+	n.l.Lock()
+	defer n.l.Unlock()
+
+	for _, c := range changes {
+		rv, exists := n.values[c.Name]
+		if !exists {
+			continue
+		}
+
+		if err := rv.apply(n.replica, c); err != nil {
+			return fmt.Errorf("Could not apply changes to %s: %s", c.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// snapshot compares the value's segments to the last known segments and
+// records an event for any that have changed. Where a segment now matches the
+// one received from a peer the peer's event is used, so that merging doesn't
+// cause the segment to be shipped back to the peer.
+//
+func (rv *replicatedValue) snapshot(replica string, received map[string]*SegmentChange) error {
+	segments, err := rv.value.Marshal()
+	if err != nil {
+		return err
+	}
+
+	var local *causality.Event
+	eventFor := func(key string, deleted bool, value []byte) causality.Event {
+		if c, exists := received[key]; exists && c.Deleted == deleted && bytes.Equal(c.Value, value) {
+			return causality.Event{Actor: c.Actor, Time: causality.LamportTime(c.Time)}
+		}
+
+		if local == nil {
+			local = &causality.Event{Actor: replica, Time: rv.version.Incr(replica)}
+		}
+
+		return *local
+	}
+
+	seen := make(map[string]struct{}, len(segments))
+	for _, s := range segments {
+		key := string(s.KeySuffix)
+		seen[key] = struct{}{}
+
+		tracked, exists := rv.segments[key]
+		if exists && !tracked.deleted && bytes.Equal(tracked.value, s.Value) {
+			continue
+		}
+
+		rv.segments[key] = &trackedSegment{
+			value: s.Value,
+			event: eventFor(key, false, s.Value),
+		}
+	}
+
+	for key, tracked := range rv.segments {
+		if _, exists := seen[key]; exists || tracked.deleted {
+			continue
+		}
+
+		rv.segments[key] = &trackedSegment{
+			event:   eventFor(key, true, nil),
+			deleted: true,
+		}
+	}
+
+	return nil
+}
+
+// missingFrom returns the segments that have changed since version
+func (rv *replicatedValue) missingFrom(version *causality.VersionVector) []*SegmentChange {
+	changes := make([]*SegmentChange, 0)
+
+	for key, tracked := range rv.segments {
+		if version.Includes(tracked.event) {
+			continue
+		}
+
+		changes = append(changes, &SegmentChange{
+			KeySuffix: []byte(key),
+			Value:     tracked.value,
+			Deleted:   tracked.deleted,
+			Actor:     tracked.event.Actor,
+			Time:      uint64(tracked.event.Time),
+		})
+	}
+
+	return changes
+}
+
+// apply merges changes from a peer into the value. Our own segments, with the
+// peer's changes laid over them, make up the peer's view of the value. That
+// is unmarshalled into a scratch value and merged into ours.
+//
+func (rv *replicatedValue) apply(replica string, changes *ValueChanges) error {
+	peerVersion, err := causality.UnmarshalVersionVector(changes.Version)
+	if err != nil {
+		return err
+	}
+
+	if len(changes.Segments) == 0 {
+		rv.version.Merge(peerVersion)
+		return nil
+	}
+
+	received := make(map[string]*SegmentChange, len(changes.Segments))
+	for _, c := range changes.Segments {
+		received[string(c.KeySuffix)] = c
+	}
+
+	segments := make([]*rapport.Segment, 0, len(rv.segments)+len(received))
+	for key, tracked := range rv.segments {
+		if _, exists := received[key]; exists || tracked.deleted {
+			continue
+		}
+
+		segments = append(segments, &rapport.Segment{
+			KeySuffix: []byte(key),
+			Value:     tracked.value,
+		})
+	}
+
+	for _, c := range changes.Segments {
+		if c.Deleted {
+			continue
+		}
+
+		segments = append(segments, &rapport.Segment{
+			KeySuffix: c.KeySuffix,
+			Value:     c.Value,
+		})
+	}
+
+	// Values expect their header segment, which has the shortest key suffix,
+	// to come first.
+	sort.Slice(segments, func(i, j int) bool {
+		return bytes.Compare(segments[i].KeySuffix, segments[j].KeySuffix) < 0
+	})
+
+	other := rv.factory()
+	if err := other.Unmarshal(segments); err != nil {
+		return err
+	}
+
+	rv.value.Merge(other)
+	rv.version.Merge(peerVersion)
+
+	return rv.snapshot(replica, received)
+}
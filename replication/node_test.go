@@ -0,0 +1,163 @@
+package replication_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/luma/pith/rapport"
+	"github.com/luma/pith/rapport/causality"
+	. "github.com/luma/pith/rapport/replication"
+)
+
+// recordingTransport records the changes that are sent by a node
+type recordingTransport struct {
+	Transport
+	sent []*ValueChanges
+}
+
+func (t *recordingTransport) Call(peer string, msg *Message) (*Message, error) {
+	t.sent = append(t.sent, msg.Changes...)
+	return t.Transport.Call(peer, msg)
+}
+
+func setValues(node *Node, name string) []string {
+	var values []string
+	err := node.View(name, func(value rapport.Value) error {
+		values = value.(*rapport.AWSet).Values()
+		return nil
+	})
+	Expect(err).ToNot(HaveOccurred())
+	return values
+}
+
+func addToSet(node *Node, name string, values ...string) {
+	err := node.Update(name, func(value rapport.Value) error {
+		value.(*rapport.AWSet).Add(values, node.Replica())
+		return nil
+	})
+	Expect(err).ToNot(HaveOccurred())
+}
+
+var _ = Describe("Node", func() {
+	var network *MemoryNetwork
+	var a, b *Node
+	var transportA *recordingTransport
+
+	createSet := func() rapport.Value { return rapport.CreateAWSet() }
+
+	BeforeEach(func() {
+		network = CreateMemoryNetwork()
+		transportA = &recordingTransport{Transport: network.Transport("a")}
+		a = CreateNode("a", transportA)
+		b = CreateNode("b", network.Transport("b"))
+
+		Expect(a.Register("set", createSet)).To(Succeed())
+		Expect(b.Register("set", createSet)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		a.Close()
+		b.Close()
+	})
+
+	Describe("Register()", func() {
+		It("rejects duplicate names", func() {
+			Expect(a.Register("set", createSet)).ToNot(Succeed())
+			Expect(a.Names()).To(Equal([]string{"set"}))
+		})
+	})
+
+	Describe("Update()", func() {
+		It("returns an error for unknown values", func() {
+			err := a.Update("nope", func(value rapport.Value) error { return nil })
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("SyncWith()", func() {
+		It("converges both nodes", func() {
+			addToSet(a, "set", "foo")
+			addToSet(b, "set", "bar")
+
+			Expect(a.SyncWith("b")).To(Succeed())
+
+			Expect(setValues(a, "set")).To(ConsistOf("foo", "bar"))
+			Expect(setValues(b, "set")).To(ConsistOf("foo", "bar"))
+
+			versionA, err := a.Version("set")
+			Expect(err).ToNot(HaveOccurred())
+			versionB, err := b.Version("set")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(versionA.Compare(versionB)).To(Equal(causality.OrderEqual))
+		})
+
+		It("replicates removals", func() {
+			addToSet(a, "set", "foo", "bar")
+			Expect(a.SyncWith("b")).To(Succeed())
+
+			err := b.Update("set", func(value rapport.Value) error {
+				value.(*rapport.AWSet).RemoveOne("foo")
+				return nil
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(a.SyncWith("b")).To(Succeed())
+			Expect(setValues(a, "set")).To(ConsistOf("bar"))
+		})
+
+		It("only ships the segments that the peer is missing", func() {
+			addToSet(a, "set", "foo", "bar", "baz")
+			Expect(a.SyncWith("b")).To(Succeed())
+			Expect(transportA.sent).To(HaveLen(1))
+
+			transportA.sent = nil
+			addToSet(a, "set", "qux")
+			Expect(a.SyncWith("b")).To(Succeed())
+
+			Expect(transportA.sent).To(HaveLen(1))
+			keys := make([]string, 0)
+			for _, s := range transportA.sent[0].Segments {
+				keys = append(keys, string(s.KeySuffix))
+			}
+
+			// Only the header and the new element have changed
+			Expect(keys).To(HaveLen(2))
+			Expect(keys).To(ContainElement(ContainSubstring("qux")))
+			Expect(setValues(b, "set")).To(ConsistOf("foo", "bar", "baz", "qux"))
+		})
+
+		It("ships nothing once the nodes have converged", func() {
+			addToSet(a, "set", "foo")
+			addToSet(b, "set", "bar")
+			Expect(a.SyncWith("b")).To(Succeed())
+
+			transportA.sent = nil
+			Expect(a.SyncWith("b")).To(Succeed())
+			Expect(transportA.sent).To(BeEmpty())
+		})
+
+		It("ignores values that the peer has not registered", func() {
+			Expect(a.Register("counter", func() rapport.Value {
+				return rapport.CreatePNCounter(a.Replica())
+			})).To(Succeed())
+
+			Expect(a.SyncWith("b")).To(Succeed())
+			Expect(b.Names()).To(Equal([]string{"set"}))
+		})
+	})
+
+	Describe("Start()", func() {
+		It("syncs with peers in the background", func() {
+			a.AddPeer("b")
+			addToSet(a, "set", "foo")
+
+			a.Start(5 * time.Millisecond)
+			Eventually(func() []string {
+				return setValues(b, "set")
+			}).Should(ConsistOf("foo"))
+			a.Stop()
+		})
+	})
+})
@@ -0,0 +1,224 @@
+package replication
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// MaxMessageSize is the largest message that a TCPTransport will read
+const MaxMessageSize = 64 * 1024 * 1024
+
+// DefaultTCPTimeout is how long a TCPTransport will wait for a peer to reply
+const DefaultTCPTimeout = 10 * time.Second
+
+// TCPTransport is a Transport that sends messages over TCP. Each message is
+// framed by a 4 byte big-endian length.
+//
+type TCPTransport struct {
+	// Timeout is how long to wait when connecting to, writing to, or
+	// reading from a peer.
+	Timeout time.Duration
+
+	listener net.Listener
+	handler  Handler
+	closed   bool
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+	l        sync.RWMutex
+}
+
+// CreateTCPTransport returns a TCPTransport that is listening on addr. Use
+// ":0" to listen on any free port, Addr() returns the port that was picked.
+//
+func CreateTCPTransport(addr string) (*TCPTransport, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &TCPTransport{
+		Timeout:  DefaultTCPTimeout,
+		listener: listener,
+		conns:    make(map[net.Conn]struct{}),
+	}
+
+	t.wg.Add(1)
+	go t.accept()
+
+	return t, nil
+}
+
+// Addr is the address that peers can use to reach this transport
+func (t *TCPTransport) Addr() string {
+	return t.listener.Addr().String()
+}
+
+// Handle sets the handler for messages from peers
+func (t *TCPTransport) Handle(handler Handler) {
+	t.l.Lock()
+	t.handler = handler
+	t.l.Unlock()
+}
+
+// Call sends a message to a peer and waits for the reply
+func (t *TCPTransport) Call(peer string, msg *Message) (*Message, error) {
+	t.l.RLock()
+	closed := t.closed
+	t.l.RUnlock()
+
+	if closed {
+		return nil, ErrTransportClosed
+	}
+
+	conn, err := net.DialTimeout("tcp", peer, t.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(t.Timeout)); err != nil {
+		return nil, err
+	}
+
+	if err := writeMessage(conn, msg); err != nil {
+		return nil, err
+	}
+
+	reply, err := readMessage(bufio.NewReader(conn))
+	if err != nil {
+		return nil, err
+	}
+
+	if reply.Type == MessageType_Error {
+		return nil, fmt.Errorf("Peer %s replied with an error: %s", peer, reply.Error)
+	}
+
+	return reply, nil
+}
+
+// Close stops listening and closes any open connections
+func (t *TCPTransport) Close() error {
+	t.l.Lock()
+	if t.closed {
+		t.l.Unlock()
+		return nil
+	}
+
+	t.closed = true
+	for conn := range t.conns {
+		conn.Close()
+	}
+	t.l.Unlock()
+
+	err := t.listener.Close()
+	t.wg.Wait()
+
+	return err
+}
+
+func (t *TCPTransport) accept() {
+	defer t.wg.Done()
+
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		t.l.Lock()
+		if t.closed {
+			t.l.Unlock()
+			conn.Close()
+			return
+		}
+
+		t.conns[conn] = struct{}{}
+		t.l.Unlock()
+
+		t.wg.Add(1)
+		go t.serve(conn)
+	}
+}
+
+func (t *TCPTransport) serve(conn net.Conn) {
+	defer func() {
+		t.l.Lock()
+		delete(t.conns, conn)
+		t.l.Unlock()
+
+		conn.Close()
+		t.wg.Done()
+	}()
+
+	r := bufio.NewReader(conn)
+
+	for {
+		msg, err := readMessage(r)
+		if err != nil {
+			return
+		}
+
+		t.l.RLock()
+		handler := t.handler
+		t.l.RUnlock()
+
+		var reply *Message
+		if handler == nil {
+			reply = &Message{Type: MessageType_Error, Error: "Not handling messages"}
+		} else if reply, err = handler(msg); err != nil {
+			reply = &Message{Type: MessageType_Error, Error: err.Error()}
+		}
+
+		if err := conn.SetWriteDeadline(time.Now().Add(t.Timeout)); err != nil {
+			return
+		}
+
+		if err := writeMessage(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func writeMessage(w io.Writer, msg *Message) error {
+	data, err := msg.Marshal()
+	if err != nil {
+		return err
+	}
+
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+
+	_, err = w.Write(frame)
+	return err
+}
+
+func readMessage(r io.Reader) (*Message, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if size > MaxMessageSize {
+		return nil, fmt.Errorf("Message of %d bytes is larger than the maximum of %d", size, MaxMessageSize)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+
+	msg := &Message{}
+	if err := msg.Unmarshal(data); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,86 @@
+package replication_test
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/luma/pith/rapport"
+	. "github.com/luma/pith/rapport/replication"
+)
+
+var _ = Describe("TCPTransport", func() {
+	var a, b *TCPTransport
+
+	BeforeEach(func() {
+		var err error
+		a, err = CreateTCPTransport("127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+
+		b, err = CreateTCPTransport("127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		a.Close()
+		b.Close()
+	})
+
+	It("delivers messages and replies", func() {
+		b.Handle(func(msg *Message) (*Message, error) {
+			return &Message{Type: MessageType_Ack, From: "b:" + msg.From}, nil
+		})
+
+		reply, err := a.Call(b.Addr(), &Message{Type: MessageType_Digest, From: "a"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reply.Type).To(Equal(MessageType_Ack))
+		Expect(reply.From).To(Equal("b:a"))
+	})
+
+	It("returns handler errors to the caller", func() {
+		b.Handle(func(msg *Message) (*Message, error) {
+			return nil, errors.New("nope")
+		})
+
+		_, err := a.Call(b.Addr(), &Message{Type: MessageType_Digest})
+		Expect(err).To(MatchError(ContainSubstring("nope")))
+	})
+
+	It("syncs nodes", func() {
+		createCounter := func(replica string) ValueFactory {
+			return func() rapport.Value { return rapport.CreatePNCounter(replica) }
+		}
+
+		nodeA := CreateNode("a", a)
+		nodeB := CreateNode("b", b)
+		Expect(nodeA.Register("hits", createCounter("a"))).To(Succeed())
+		Expect(nodeB.Register("hits", createCounter("b"))).To(Succeed())
+
+		incr := func(node *Node, amount int64) {
+			err := node.Update("hits", func(value rapport.Value) error {
+				value.(*rapport.PNCounter).IncrBy(amount)
+				return nil
+			})
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		incr(nodeA, 2)
+		incr(nodeB, 3)
+		Expect(nodeA.SyncWith(b.Addr())).To(Succeed())
+
+		for _, node := range []*Node{nodeA, nodeB} {
+			err := node.View("hits", func(value rapport.Value) error {
+				Expect(value.(*rapport.PNCounter).Value()).To(Equal(int64(5)))
+				return nil
+			})
+			Expect(err).ToNot(HaveOccurred())
+		}
+	})
+
+	It("fails to call once closed", func() {
+		a.Close()
+		_, err := a.Call(b.Addr(), &Message{})
+		Expect(err).To(Equal(ErrTransportClosed))
+	})
+})
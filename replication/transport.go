@@ -0,0 +1,156 @@
+package replication
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrTransportClosed is returned when using a transport that has been closed
+var ErrTransportClosed = errors.New("Transport is closed")
+
+// Handler handles a message from a peer and returns the reply
+type Handler func(msg *Message) (*Message, error)
+
+// Transport carries messages between replicas. It's request/response: every
+// message that is sent to a peer gets a single reply.
+//
+type Transport interface {
+	// Addr is the address that peers can use to reach this transport
+	Addr() string
+
+	// Call sends a message to a peer and waits for the reply
+	Call(peer string, msg *Message) (*Message, error)
+
+	// Handle sets the handler for messages from peers
+	Handle(handler Handler)
+
+	// Close stops the transport from sending or receiving messages
+	Close() error
+}
+
+// MemoryNetwork connects MemoryTransports to each other, it's useful for
+// testing replication without any sockets.
+//
+type MemoryNetwork struct {
+	transports map[string]*MemoryTransport
+	l          sync.RWMutex
+}
+
+// CreateMemoryNetwork returns a new, empty, MemoryNetwork
+func CreateMemoryNetwork() *MemoryNetwork {
+	return &MemoryNetwork{
+		transports: make(map[string]*MemoryTransport),
+	}
+}
+
+// Transport returns a new MemoryTransport that is reachable at addr
+func (n *MemoryNetwork) Transport(addr string) *MemoryTransport {
+	t := &MemoryTransport{
+		addr:    addr,
+		network: n,
+	}
+
+	n.l.Lock()
+	n.transports[addr] = t
+	n.l.Unlock()
+
+	return t
+}
+
+func (n *MemoryNetwork) get(addr string) (*MemoryTransport, bool) {
+	n.l.RLock()
+	t, exists := n.transports[addr]
+	n.l.RUnlock()
+	return t, exists
+}
+
+func (n *MemoryNetwork) remove(addr string) {
+	n.l.Lock()
+	delete(n.transports, addr)
+	n.l.Unlock()
+}
+
+// MemoryTransport is a Transport that delivers messages in process. Messages
+// are still marshalled so that the receiver never shares memory with the
+// sender.
+//
+type MemoryTransport struct {
+	addr    string
+	network *MemoryNetwork
+	handler Handler
+	closed  bool
+	l       sync.RWMutex
+}
+
+// Addr is the address that peers can use to reach this transport
+func (t *MemoryTransport) Addr() string {
+	return t.addr
+}
+
+// Handle sets the handler for messages from peers
+func (t *MemoryTransport) Handle(handler Handler) {
+	t.l.Lock()
+	t.handler = handler
+	t.l.Unlock()
+}
+
+// Call sends a message to a peer and waits for the reply
+func (t *MemoryTransport) Call(peer string, msg *Message) (*Message, error) {
+	t.l.RLock()
+	closed := t.closed
+	t.l.RUnlock()
+
+	if closed {
+		return nil, ErrTransportClosed
+	}
+
+	other, exists := t.network.get(peer)
+	if !exists {
+		return nil, fmt.Errorf("Unknown peer: %s", peer)
+	}
+
+	other.l.RLock()
+	handler := other.handler
+	other.l.RUnlock()
+
+	if handler == nil {
+		return nil, fmt.Errorf("Peer %s is not handling messages", peer)
+	}
+
+	request, err := copyMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := handler(request)
+	if err != nil {
+		return nil, err
+	}
+
+	return copyMessage(reply)
+}
+
+// Close removes the transport from the network
+func (t *MemoryTransport) Close() error {
+	t.l.Lock()
+	t.closed = true
+	t.l.Unlock()
+
+	t.network.remove(t.addr)
+	return nil
+}
+
+func copyMessage(msg *Message) (*Message, error) {
+	data, err := msg.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	copied := &Message{}
+	if err := copied.Unmarshal(data); err != nil {
+		return nil, err
+	}
+
+	return copied, nil
+}
@@ -0,0 +1,157 @@
+package rapport
+
+import (
+	"sync"
+
+	"github.com/luma/pith/rapport/marshalling"
+)
+
+// ResettableCounter is a PN-Counter that can be reset to zero, with
+// observed-reset semantics. A reset records the increments and decrements, of
+// every replica, that it has observed and the value of the counter only
+// counts those that came after. Increments or decrements that are concurrent
+// with a reset are not lost when the counters are merged.
+//
+// It's a Resetter, so when its key is removed from an AWMap the counter is
+// reset rather than discarded. Re-add the key with AWMap.Update, which carries
+// on from the reset counter, rather than AWMap.Put. Put merges a new counter
+// with the reset one, and the new counter's increments are lost wherever they
+// are no more than the increments the reset has observed.
+//
+type ResettableCounter struct {
+	replicaId string
+
+	value *marshalling.ResettableCounterValue
+	l     sync.RWMutex
+}
+
+// CreateResettableCounter returns a new ResettableCounter, for a specific
+// replica, that starts at zero.
+//
+func CreateResettableCounter(replicaId string) *ResettableCounter {
+	return &ResettableCounter{
+		replicaId: replicaId,
+		value:     marshalling.CreateResettableCounter(replicaId),
+	}
+}
+
+// Incr increments the counter by 1 and returns the new value
+func (r *ResettableCounter) Incr() int64 {
+	return r.IncrBy(1)
+}
+
+// IncrBy increments the counter by amount, a negative amount decrements it,
+// and returns the new value.
+//
+func (r *ResettableCounter) IncrBy(amount int64) int64 {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	r.value.Counter.IncrBy(r.replicaId, amount)
+	return r.value.Value()
+}
+
+// Decr decrements the counter by 1 and returns the new value
+func (r *ResettableCounter) Decr() (int64, error) {
+	return r.DecrBy(1)
+}
+
+// DecrBy decrements the counter by amount and returns the new value
+func (r *ResettableCounter) DecrBy(amount int64) (int64, error) {
+	return r.IncrBy(-amount), nil
+}
+
+// Value returns the value of the counter
+func (r *ResettableCounter) Value() int64 {
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	return r.value.Value()
+}
+
+// Reset sets the counter back to zero. Only the increments and decrements
+// that this replica has observed are reset, those made concurrently by other
+// replicas will still count once the counters have been merged.
+//
+func (r *ResettableCounter) Reset() {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	mergePNCounterValues(r.value.Reset, r.value.Counter)
+}
+
+// Merge another ResettableCounter into this one. The increments, decrements,
+// and the resets of each, are merged by taking their maximums.
+//
+func (r *ResettableCounter) Merge(crdt CRDT) {
+	other := crdt.(*ResettableCounter)
+
+	r.l.Lock()
+	other.l.RLock()
+
+	defer func() {
+		r.l.Unlock()
+		other.l.RUnlock()
+	}()
+
+	mergePNCounterValues(r.value.Counter, other.value.Counter)
+	mergePNCounterValues(r.value.Reset, other.value.Reset)
+}
+
+// Marshal serialises the counter data to bytes
+func (r *ResettableCounter) Marshal() ([]*Segment, error) {
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	v, err := r.value.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	segment := &Segment{
+		Value: v,
+	}
+	return []*Segment{segment}, nil
+}
+
+// Unmarshal deserialises the counter data from bytes
+func (r *ResettableCounter) Unmarshal(data []*Segment) error {
+	value := &marshalling.ResettableCounterValue{}
+	if err := value.Unmarshal(data[0].Value); err != nil {
+		return err
+	}
+
+	value.Counter = ensurePNCounterValue(value.Counter, r.replicaId)
+	value.Reset = ensurePNCounterValue(value.Reset, r.replicaId)
+
+	r.l.Lock()
+	r.value = value
+	r.l.Unlock()
+
+	return nil
+}
+
+func (r *ResettableCounter) bindReplica(replica string) {
+	r.l.Lock()
+	r.replicaId = replica
+	r.l.Unlock()
+}
+
+// ensurePNCounterValue returns value, or a new PNCounterValue if it's nil, with
+// it's maps initialised. Unmarshalling leaves empty maps as nil.
+//
+func ensurePNCounterValue(value *marshalling.PNCounterValue, replicaId string) *marshalling.PNCounterValue {
+	if value == nil {
+		return marshalling.CreatePNCounter(replicaId)
+	}
+
+	if value.Inc == nil {
+		value.Inc = make(map[string]int64)
+	}
+
+	if value.Dec == nil {
+		value.Dec = make(map[string]int64)
+	}
+
+	return value
+}
@@ -0,0 +1,118 @@
+package rapport_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/luma/pith/rapport"
+)
+
+var _ = Describe("ResettableCounter", func() {
+	var counter *ResettableCounter
+
+	JustBeforeEach(func() {
+		counter = CreateResettableCounter("replica1")
+	})
+
+	It("starts at zero", func() {
+		Expect(counter.Value()).To(Equal(int64(0)))
+	})
+
+	It("is a Counter", func() {
+		var c Counter = counter
+		Expect(c.IncrBy(3)).To(Equal(int64(3)))
+
+		value, err := c.DecrBy(5)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(value).To(Equal(int64(-2)))
+	})
+
+	Describe("Reset()", func() {
+		It("sets the counter back to zero", func() {
+			counter.IncrBy(5)
+			counter.Decr()
+
+			counter.Reset()
+			Expect(counter.Value()).To(Equal(int64(0)))
+
+			Expect(counter.Incr()).To(Equal(int64(1)))
+		})
+
+		It("converges when merged", func() {
+			counter2 := CreateResettableCounter("replica2")
+			counter.IncrBy(5)
+			counter2.IncrBy(3)
+			counter2.Merge(counter)
+
+			counter2.Reset()
+
+			counter.Merge(counter2)
+			Expect(counter.Value()).To(Equal(int64(0)))
+			Expect(counter2.Value()).To(Equal(int64(0)))
+		})
+
+		It("keeps increments that are concurrent with it", func() {
+			counter2 := CreateResettableCounter("replica2")
+			counter.IncrBy(5)
+			counter2.Merge(counter)
+
+			counter2.Reset()
+			counter.IncrBy(2)
+			counter.DecrBy(1)
+
+			counter.Merge(counter2)
+			counter2.Merge(counter)
+
+			Expect(counter.Value()).To(Equal(int64(1)))
+			Expect(counter2.Value()).To(Equal(int64(1)))
+		})
+
+		It("merges concurrent resets", func() {
+			counter2 := CreateResettableCounter("replica2")
+			counter.IncrBy(5)
+			counter2.IncrBy(3)
+			counter2.Merge(counter)
+			counter.IncrBy(4)
+
+			counter.Reset()
+			counter2.Reset()
+
+			counter.Merge(counter2)
+			counter2.Merge(counter)
+
+			Expect(counter.Value()).To(Equal(int64(0)))
+			Expect(counter2.Value()).To(Equal(int64(0)))
+		})
+	})
+
+	Describe("Merge()", func() {
+		It("sums the counts from different replicas", func() {
+			counter2 := CreateResettableCounter("replica2")
+			counter.IncrBy(3)
+			counter2.DecrBy(1)
+
+			counter.Merge(counter2)
+			counter.Merge(counter2)
+
+			Expect(counter.Value()).To(Equal(int64(2)))
+		})
+	})
+
+	Describe("Marshal()", func() {
+		It("round trips through Unmarshal()", func() {
+			counter.IncrBy(5)
+			counter.Reset()
+			counter.IncrBy(2)
+
+			segments, err := counter.Marshal()
+			Expect(err).ToNot(HaveOccurred())
+
+			counter2 := CreateResettableCounter("replica1")
+			Expect(counter2.Unmarshal(segments)).To(Succeed())
+
+			Expect(counter2.Value()).To(Equal(int64(2)))
+			counter2.Reset()
+			Expect(counter2.Value()).To(Equal(int64(0)))
+		})
+	})
+})
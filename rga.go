@@ -0,0 +1,360 @@
+package rapport
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/luma/pith/keys"
+	"github.com/luma/pith/rapport/causality"
+)
+
+// rgaHead is the origin of elements that are inserted at the head of the
+// sequence
+var rgaHead = causality.Event{}
+
+// rgaElement is a single element of a RGA
+type rgaElement struct {
+	id      causality.Event
+	origin  causality.Event
+	value   string
+	deleted bool
+}
+
+// RGA is a Replicated Growable Array, an ordered sequence suitable for
+// collaborative lists and text.
+//
+// Each element is identified by the replica that inserted it and a
+// LamportTime, and is placed immediately after the element it was inserted
+// after (it's origin). Concurrent inserts after the same origin are ordered by
+// their identifiers, newest first. Deleted elements are kept as tombstones so
+// that concurrent inserts can still find their origin.
+//
+type RGA struct {
+	clock    causality.LamportClock
+	elements []*rgaElement
+	ids      map[causality.Event]*rgaElement
+	l        sync.RWMutex
+}
+
+// CreateRGA returns a new, empty RGA.
+//
+func CreateRGA() *RGA {
+	return &RGA{
+		clock:    causality.CreateLamportClock(0),
+		elements: make([]*rgaElement, 0),
+		ids:      make(map[causality.Event]*rgaElement),
+	}
+}
+
+// Insert inserts value at index for a specific replica. Elements at or after
+// index are moved along by one. It returns an error if index is out of range.
+//
+func (r *RGA) Insert(index int, value string, replica string) error {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	origin := rgaHead
+	if index != 0 {
+		previous := r.visible(index - 1)
+		if previous == nil {
+			return fmt.Errorf("Cannot insert into sequence, index out of range: %d", index)
+		}
+
+		origin = previous.id
+	}
+
+	r.integrate(&rgaElement{
+		id: causality.Event{
+			Actor: replica,
+			Time:  r.clock.Incr(),
+		},
+		origin: origin,
+		value:  value,
+	})
+
+	return nil
+}
+
+// Delete removes the value at index. It returns an error if index is out of
+// range.
+//
+func (r *RGA) Delete(index int) error {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	element := r.visible(index)
+	if element == nil {
+		return fmt.Errorf("Cannot delete from sequence, index out of range: %d", index)
+	}
+
+	element.deleted = true
+	return nil
+}
+
+// Get returns the value at index. It returns an error if index is out of
+// range.
+//
+func (r *RGA) Get(index int) (string, error) {
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	element := r.visible(index)
+	if element == nil {
+		return "", fmt.Errorf("Sequence index out of range: %d", index)
+	}
+
+	return element.value, nil
+}
+
+// Len returns the number of values in the sequence
+func (r *RGA) Len() int {
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	count := 0
+	for _, element := range r.elements {
+		if !element.deleted {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Values returns the values in the sequence, in order
+func (r *RGA) Values() []string {
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	values := make([]string, 0, len(r.elements))
+	for _, element := range r.elements {
+		if !element.deleted {
+			values = append(values, element.value)
+		}
+	}
+
+	return values
+}
+
+// Merge another RGA into this one
+//
+func (r *RGA) Merge(crdt CRDT) {
+	other := crdt.(*RGA)
+
+	r.l.Lock()
+	other.l.RLock()
+
+	defer func() {
+		r.l.Unlock()
+		other.l.RUnlock()
+	}()
+
+	// An element always comes after it's origin, so walking the other
+	// sequence in order guarantees that we've seen the origin of each element
+	// before we integrate it.
+	for _, otherElement := range other.elements {
+		if element, exists := r.ids[otherElement.id]; exists {
+			element.deleted = element.deleted || otherElement.deleted
+			continue
+		}
+
+		element := *otherElement
+		r.integrate(&element)
+	}
+
+	r.clock.Merge(other.clock.Value())
+}
+
+// Marshal serialises the sequence data to bytes. Each element is serialised as
+// it's own Segment so that edits only rewrite the segments they touch.
+//
+func (r *RGA) Marshal() ([]*Segment, error) {
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	segments := make([]*Segment, 0, 1+len(r.elements))
+
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint64(header, uint64(r.clock.Value()))
+
+	segments = append(segments, &Segment{
+		Value: header,
+	})
+
+	for _, element := range r.elements {
+		value := &RGAElement{
+			Value:         element.value,
+			OriginReplica: element.origin.Actor,
+			OriginTime:    uint64(element.origin.Time),
+			Deleted:       element.deleted,
+		}
+
+		b, err := value.Marshal()
+		if err != nil {
+			return nil, err
+		}
+
+		segments = append(segments, &Segment{
+			KeySuffix: keys.Make(EntriesKey, marshalRGAId(element.id)),
+			Value:     b,
+		})
+	}
+
+	return segments, nil
+}
+
+// Unmarshal deserialises the sequence data from bytes
+func (r *RGA) Unmarshal(data []*Segment) error {
+	if len(data[0].Value) != 8 {
+		return fmt.Errorf("Unexpected header for sequence: %v", data[0].Value)
+	}
+
+	clock := causality.CreateLamportClock(causality.LamportTime(binary.BigEndian.Uint64(data[0].Value)))
+	children := make(map[causality.Event][]*rgaElement)
+	ids := make(map[causality.Event]*rgaElement)
+
+	for _, s := range data[1:] {
+		if s.KeySuffix[0] != EntriesKey[0] {
+			return fmt.Errorf("Unexpected key suffix for sequence: %s", s.KeySuffix)
+		}
+
+		// Strip off the key sigil to get at the element id
+		id, err := unmarshalRGAId(s.KeySuffix[2:])
+		if err != nil {
+			return err
+		}
+
+		value := &RGAElement{}
+		if err := value.Unmarshal(s.Value); err != nil {
+			return err
+		}
+
+		element := &rgaElement{
+			id: id,
+			origin: causality.Event{
+				Actor: value.OriginReplica,
+				Time:  causality.LamportTime(value.OriginTime),
+			},
+			value:   value.Value,
+			deleted: value.Deleted,
+		}
+
+		children[element.origin] = append(children[element.origin], element)
+		ids[id] = element
+	}
+
+	// Rebuild the order of the sequence by walking the tree of origins,
+	// depth first, visiting newer siblings first.
+	elements := make([]*rgaElement, 0, len(ids))
+	stack := []causality.Event{rgaHead}
+
+	for len(stack) > 0 {
+		origin := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if origin != rgaHead {
+			elements = append(elements, ids[origin])
+		}
+
+		siblings := children[origin]
+		sort.Slice(siblings, func(i, j int) bool {
+			return rgaIdLess(siblings[i].id, siblings[j].id)
+		})
+
+		// The newest sibling is pushed last so it's visited first
+		for _, sibling := range siblings {
+			stack = append(stack, sibling.id)
+		}
+	}
+
+	if len(elements) != len(ids) {
+		return fmt.Errorf("Sequence data contains elements with missing origins")
+	}
+
+	r.l.Lock()
+	r.clock = clock
+	r.elements = elements
+	r.ids = ids
+	r.l.Unlock()
+
+	return nil
+}
+
+// visible returns the element at index, ignoring deleted elements, or nil if
+// index is out of range.
+//
+// This method is not thread safe
+//
+func (r *RGA) visible(index int) *rgaElement {
+	if index < 0 {
+		return nil
+	}
+
+	for _, element := range r.elements {
+		if element.deleted {
+			continue
+		}
+
+		if index == 0 {
+			return element
+		}
+
+		index--
+	}
+
+	return nil
+}
+
+// integrate inserts element after it's origin, skipping over any newer
+// elements that were concurrently inserted after the same origin.
+//
+// This method is not thread safe
+//
+func (r *RGA) integrate(element *rgaElement) {
+	pos := 0
+	if element.origin != rgaHead {
+		for i, e := range r.elements {
+			if e.id == element.origin {
+				pos = i + 1
+				break
+			}
+		}
+	}
+
+	for pos < len(r.elements) && rgaIdLess(element.id, r.elements[pos].id) {
+		pos++
+	}
+
+	r.elements = append(r.elements, nil)
+	copy(r.elements[pos+1:], r.elements[pos:])
+	r.elements[pos] = element
+	r.ids[element.id] = element
+}
+
+// rgaIdLess orders element ids by LamportTime and then by replica
+func rgaIdLess(a causality.Event, b causality.Event) bool {
+	if a.Time == b.Time {
+		return a.Actor < b.Actor
+	}
+
+	return a.Time < b.Time
+}
+
+func marshalRGAId(id causality.Event) []byte {
+	b := make([]byte, 8, 8+len(id.Actor))
+	binary.BigEndian.PutUint64(b, uint64(id.Time))
+	return append(b, id.Actor...)
+}
+
+func unmarshalRGAId(data []byte) (causality.Event, error) {
+	if len(data) < 8 {
+		return rgaHead, fmt.Errorf("Malformed sequence element id: %v", data)
+	}
+
+	return causality.Event{
+		Actor: string(data[8:]),
+		Time:  causality.LamportTime(binary.BigEndian.Uint64(data[:8])),
+	}, nil
+}
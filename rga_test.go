@@ -0,0 +1,166 @@
+package rapport_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/luma/pith/rapport"
+)
+
+var _ = Describe("RGA", func() {
+	var seq *RGA
+
+	JustBeforeEach(func() {
+		seq = CreateRGA()
+		Expect(seq.Insert(0, "a", "replica1")).To(Succeed())
+		Expect(seq.Insert(1, "b", "replica1")).To(Succeed())
+		Expect(seq.Insert(2, "c", "replica1")).To(Succeed())
+	})
+
+	It("satisfies the Sequence contract", func() {
+		var s Sequence = seq
+		Expect(s.Len()).To(Equal(3))
+	})
+
+	Describe("Insert()", func() {
+		It("appends values", func() {
+			Expect(seq.Values()).To(Equal([]string{"a", "b", "c"}))
+		})
+
+		It("inserts values at the head", func() {
+			seq.Insert(0, "z", "replica1")
+			Expect(seq.Values()).To(Equal([]string{"z", "a", "b", "c"}))
+		})
+
+		It("inserts values in the middle", func() {
+			seq.Insert(1, "z", "replica1")
+			Expect(seq.Values()).To(Equal([]string{"a", "z", "b", "c"}))
+		})
+
+		It("returns an error when the index is out of range", func() {
+			Expect(seq.Insert(4, "z", "replica1")).ToNot(Succeed())
+			Expect(seq.Insert(-1, "z", "replica1")).ToNot(Succeed())
+		})
+	})
+
+	Describe("Delete()", func() {
+		It("removes the value", func() {
+			Expect(seq.Delete(1)).To(Succeed())
+			Expect(seq.Values()).To(Equal([]string{"a", "c"}))
+			Expect(seq.Len()).To(Equal(2))
+		})
+
+		It("returns an error when the index is out of range", func() {
+			Expect(seq.Delete(3)).ToNot(Succeed())
+		})
+
+		It("skips deleted values when inserting", func() {
+			seq.Delete(1)
+			seq.Insert(2, "d", "replica1")
+			Expect(seq.Values()).To(Equal([]string{"a", "c", "d"}))
+		})
+	})
+
+	Describe("Get()", func() {
+		It("returns the value at the index", func() {
+			value, err := seq.Get(2)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(value).To(Equal("c"))
+		})
+	})
+
+	Describe("Merge()", func() {
+		var seq2 *RGA
+
+		JustBeforeEach(func() {
+			seq2 = CreateRGA()
+			seq2.Merge(seq)
+		})
+
+		It("copies the other sequence", func() {
+			Expect(seq2.Values()).To(Equal([]string{"a", "b", "c"}))
+		})
+
+		It("converges when inserting concurrently at the same position", func() {
+			seq.Insert(1, "x", "replica1")
+			seq2.Insert(1, "y", "replica2")
+
+			seq.Merge(seq2)
+			seq2.Merge(seq)
+
+			Expect(seq.Values()).To(Equal(seq2.Values()))
+			Expect(seq.Values()).To(HaveLen(5))
+		})
+
+		It("keeps runs of concurrent inserts together", func() {
+			seq.Insert(3, "d", "replica1")
+			seq.Insert(4, "e", "replica1")
+			seq2.Insert(3, "x", "replica2")
+			seq2.Insert(4, "y", "replica2")
+
+			seq.Merge(seq2)
+			seq2.Merge(seq)
+
+			Expect(seq.Values()).To(Equal(seq2.Values()))
+			Expect(seq.Values()).To(BeElementOf(
+				[]string{"a", "b", "c", "d", "e", "x", "y"},
+				[]string{"a", "b", "c", "x", "y", "d", "e"},
+			))
+		})
+
+		It("applies deletes and inserts concurrently", func() {
+			seq.Delete(1)
+			seq2.Insert(2, "x", "replica2")
+
+			seq.Merge(seq2)
+			seq2.Merge(seq)
+
+			Expect(seq.Values()).To(Equal([]string{"a", "x", "c"}))
+			Expect(seq2.Values()).To(Equal([]string{"a", "x", "c"}))
+		})
+
+		It("orders inserts after values that were merged", func() {
+			seq2.Insert(0, "x", "replica2")
+			seq.Merge(seq2)
+			seq.Insert(0, "y", "replica1")
+
+			seq2.Merge(seq)
+
+			Expect(seq2.Values()).To(Equal([]string{"y", "x", "a", "b", "c"}))
+		})
+	})
+
+	Describe("Marshal()", func() {
+		It("marshals each element as a separate segment", func() {
+			seq.Delete(0)
+			segments, err := seq.Marshal()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(segments).To(HaveLen(4))
+		})
+
+		It("round trips through Unmarshal()", func() {
+			seq2 := CreateRGA()
+			seq2.Merge(seq)
+			seq.Insert(1, "x", "replica1")
+			seq2.Insert(1, "y", "replica2")
+			seq.Merge(seq2)
+			seq.Delete(0)
+
+			segments, err := seq.Marshal()
+			Expect(err).ToNot(HaveOccurred())
+
+			// Reverse the segments to show that the order is not significant
+			for i, j := 1, len(segments)-1; i < j; i, j = i+1, j-1 {
+				segments[i], segments[j] = segments[j], segments[i]
+			}
+
+			seq3 := CreateRGA()
+			Expect(seq3.Unmarshal(segments)).To(Succeed())
+			Expect(seq3.Values()).To(Equal(seq.Values()))
+
+			seq3.Insert(0, "z", "replica3")
+			seq.Merge(seq3)
+			Expect(seq.Values()[0]).To(Equal("z"))
+		})
+	})
+})
@@ -0,0 +1,145 @@
+package rapport
+
+import (
+	"encoding/binary"
+
+	"github.com/luma/pith/rapport/store"
+)
+
+// SegmentKey returns the store key for a segment of the value at key. It's
+// PrefixSegmentKey + key + keySuffix, where the key is prefixed by its length
+// so that the segments of one key never sort amongst those of another.
+//
+func SegmentKey(key []byte, keySuffix []byte) []byte {
+	prefix := segmentKeyPrefix(key)
+	return append(prefix, keySuffix...)
+}
+
+func segmentKeyPrefix(key []byte) []byte {
+	prefix := make([]byte, 0, len(PrefixSegmentKey)+binary.MaxVarintLen64+len(key))
+	prefix = append(prefix, PrefixSegmentKey...)
+	prefix = binary.AppendUvarint(prefix, uint64(len(key)))
+	return append(prefix, key...)
+}
+
+// SaveValue writes the segments of value to the store under key. Segments
+// that were previously saved, but that the value no longer has, are deleted.
+// It's all written as a single batch.
+//
+func SaveValue(s store.Store, key []byte, value Marshaler) error {
+	segments, err := value.Marshal()
+	if err != nil {
+		return err
+	}
+
+	prefix := segmentKeyPrefix(key)
+	current := make(map[string]struct{}, len(segments))
+	batch := store.CreateBatch()
+
+	for _, segment := range segments {
+		segmentKey := append(append(make([]byte, 0, len(prefix)+len(segment.KeySuffix)), prefix...), segment.KeySuffix...)
+		current[string(segmentKey)] = struct{}{}
+		batch.Put(segmentKey, segment.Value)
+	}
+
+	it, err := s.Scan(prefix)
+	if err != nil {
+		return err
+	}
+
+	defer it.Close()
+
+	for it.Next() {
+		if _, exists := current[string(it.Key())]; !exists {
+			batch.Delete(it.Key())
+		}
+	}
+
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	return s.Write(batch)
+}
+
+// LoadValue reads the segments under key from the store and unmarshals them
+// into value. It returns store.ErrNotFound if there are no segments for key.
+//
+func LoadValue(s store.Store, key []byte, value Marshaler) error {
+	prefix := segmentKeyPrefix(key)
+	it, err := s.Scan(prefix)
+	if err != nil {
+		return err
+	}
+
+	defer it.Close()
+
+	// Segments come out sorted by key suffix, which means the header segment,
+	// with its empty key suffix, is first.
+	segments := make([]*Segment, 0)
+	for it.Next() {
+		segments = append(segments, &Segment{
+			KeySuffix: it.Key()[len(prefix):],
+			Value:     it.Value(),
+		})
+	}
+
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	if len(segments) == 0 {
+		return store.ErrNotFound
+	}
+
+	return value.Unmarshal(segments)
+}
+
+// DeleteValue deletes all the segments under key from the store
+func DeleteValue(s store.Store, key []byte) error {
+	it, err := s.Scan(segmentKeyPrefix(key))
+	if err != nil {
+		return err
+	}
+
+	defer it.Close()
+
+	batch := store.CreateBatch()
+	for it.Next() {
+		batch.Delete(it.Key())
+	}
+
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	return s.Write(batch)
+}
+
+// SaveChanges writes only the segments of value that have changed since they
+// were last saved, and deletes the segments that it no longer has. It's
+// written as a single batch. The changes are only committed once the batch
+// has been written, so they're retried by the next SaveChanges if it fails.
+//
+func SaveChanges(s store.Store, key []byte, value ChangeMarshaler) error {
+	updated, deleted, commit, err := value.MarshalChanges()
+	if err != nil {
+		return err
+	}
+
+	batch := store.CreateBatch()
+	for _, segment := range updated {
+		batch.Put(SegmentKey(key, segment.KeySuffix), segment.Value)
+	}
+
+	for _, keySuffix := range deleted {
+		batch.Delete(SegmentKey(key, keySuffix))
+	}
+
+	if err := s.Write(batch); err != nil {
+		return err
+	}
+
+	commit()
+	return nil
+}
@@ -0,0 +1,351 @@
+package store
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	opPut    = byte(1)
+	opDelete = byte(2)
+
+	recordHeaderSize = 8
+)
+
+var errCorruptRecord = errors.New("Corrupt record in store file")
+
+// FileStore is a Store that persists to an append-only log file. Each batch
+// is written as a single checksummed record, so a batch is either entirely in
+// the log or not at all.
+//
+// The whole keyspace is also held in memory, the log is replayed into it when
+// the store is opened. Compact rewrites the log with only the live keys.
+//
+type FileStore struct {
+	*MemoryStore
+
+	path string
+	file *os.File
+	l    sync.Mutex
+
+	// err is set when a failed write couldn't be removed from the log, no
+	// more writes are allowed as they would be appended after it
+	err error
+}
+
+// OpenFileStore opens, or creates, the FileStore at path. If the store wasn't
+// closed cleanly any partially written record at the end of the log is
+// discarded. It returns ErrCorrupt, rather than discarding any records, if a
+// record before the end of the log is corrupt.
+//
+func OpenFileStore(path string) (*FileStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &FileStore{
+		MemoryStore: CreateMemoryStore(),
+		path:        path,
+		file:        file,
+	}
+
+	size, err := s.replay()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// Drop anything after the last good record, so that new records aren't
+	// appended after garbage.
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if _, err := file.Seek(size, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Put sets the value for key
+func (s *FileStore) Put(key []byte, value []byte) error {
+	batch := CreateBatch()
+	batch.Put(key, value)
+	return s.Write(batch)
+}
+
+// Delete removes key
+func (s *FileStore) Delete(key []byte) error {
+	batch := CreateBatch()
+	batch.Delete(key)
+	return s.Write(batch)
+}
+
+// Write appends the batch to the log, and then applies it. If the batch can't
+// be appended then whatever was written of it is removed from the log, if that
+// fails too then the store refuses any more writes.
+//
+func (s *FileStore) Write(batch *Batch) error {
+	if batch.Len() == 0 {
+		return nil
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if s.file == nil {
+		return ErrClosed
+	} else if s.err != nil {
+		return s.err
+	}
+
+	offset, err := s.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.file.Write(encodeRecord(batch.ops)); err != nil {
+		s.truncate(offset)
+		return err
+	}
+
+	if err := s.file.Sync(); err != nil {
+		s.truncate(offset)
+		return err
+	}
+
+	return s.MemoryStore.Write(batch)
+}
+
+// truncate removes everything after offset from the log, so that a failed
+// write isn't replayed and new records aren't appended after it
+//
+// This method is not thread safe
+//
+func (s *FileStore) truncate(offset int64) {
+	if err := s.file.Truncate(offset); err != nil {
+		s.err = err
+		return
+	}
+
+	if _, err := s.file.Seek(offset, io.SeekStart); err != nil {
+		s.err = err
+		return
+	}
+
+	if err := s.file.Sync(); err != nil {
+		s.err = err
+	}
+}
+
+// Compact rewrites the log so that it only contains the live keys
+func (s *FileStore) Compact() error {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if s.file == nil {
+		return ErrClosed
+	}
+
+	it, err := s.MemoryStore.Scan(nil)
+	if err != nil {
+		return err
+	}
+
+	defer it.Close()
+
+	ops := make([]batchOp, 0)
+	for it.Next() {
+		ops = append(ops, batchOp{key: it.Key(), value: it.Value()})
+	}
+
+	tmpPath := s.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if len(ops) > 0 {
+		if _, err := tmp.Write(encodeRecord(ops)); err != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+			return err
+		}
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// The new log doesn't have any failed writes in it
+	s.file.Close()
+	s.file = tmp
+	s.err = nil
+	return nil
+}
+
+// Close closes the log file
+func (s *FileStore) Close() error {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+	s.MemoryStore.Close()
+
+	return err
+}
+
+// replay reads the log into memory. It returns the size of the log up to the
+// end of the last good record. A bad record is only discarded if it's the last
+// thing in the log, as that's what an interrupted write leaves behind. A record
+// that is cut short is only the last thing in the log if there isn't a good
+// record after it, as a corrupt length can make any record look cut short.
+//
+func (s *FileStore) replay() (int64, error) {
+	info, err := s.file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	r := bufio.NewReader(s.file)
+	size := int64(0)
+
+	for {
+		ops, n, err := decodeRecord(r, info.Size()-size)
+		if err == errCorruptRecord && size+n < info.Size() {
+			return 0, ErrCorrupt
+		} else if err == io.ErrUnexpectedEOF && s.recordAfter(size, info.Size()) {
+			return 0, ErrCorrupt
+		} else if err == io.EOF || err == io.ErrUnexpectedEOF || err == errCorruptRecord {
+			return size, nil
+		} else if err != nil {
+			return 0, err
+		}
+
+		s.MemoryStore.apply(ops)
+		size += n
+	}
+}
+
+// recordAfter indicates whether there's a good record that starts anywhere
+// after offset, and before end, in the log
+//
+func (s *FileStore) recordAfter(offset int64, end int64) bool {
+	for start := offset + 1; start+recordHeaderSize < end; start++ {
+		r := io.NewSectionReader(s.file, start, end-start)
+		if ops, _, err := decodeRecord(r, end-start); err == nil && len(ops) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// encodeRecord encodes ops as a log record, that's a crc32 of the payload,
+// the length of the payload, and then the payload itself.
+//
+func encodeRecord(ops []batchOp) []byte {
+	payload := make([]byte, 0, 64)
+	for _, op := range ops {
+		if op.delete {
+			payload = append(payload, opDelete)
+			payload = binary.AppendUvarint(payload, uint64(len(op.key)))
+			payload = append(payload, op.key...)
+			continue
+		}
+
+		payload = append(payload, opPut)
+		payload = binary.AppendUvarint(payload, uint64(len(op.key)))
+		payload = append(payload, op.key...)
+		payload = binary.AppendUvarint(payload, uint64(len(op.value)))
+		payload = append(payload, op.value...)
+	}
+
+	record := make([]byte, recordHeaderSize, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], crc32.ChecksumIEEE(payload))
+	binary.BigEndian.PutUint32(record[4:8], uint32(len(payload)))
+
+	return append(record, payload...)
+}
+
+// decodeRecord reads a single record, returning its ops and its size. No more
+// than remaining bytes will be read. The size is also returned with
+// errCorruptRecord.
+//
+func decodeRecord(r io.Reader, remaining int64) ([]batchOp, int64, error) {
+	var header [recordHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, 0, err
+	}
+
+	checksum := binary.BigEndian.Uint32(header[0:4])
+	length := int64(binary.BigEndian.Uint32(header[4:8]))
+	if length > remaining-recordHeaderSize {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, 0, err
+	}
+
+	size := int64(recordHeaderSize + len(payload))
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return nil, size, errCorruptRecord
+	}
+	ops := make([]batchOp, 0)
+
+	for len(payload) > 0 {
+		op := batchOp{delete: payload[0] == opDelete}
+		if payload[0] != opPut && payload[0] != opDelete {
+			return nil, size, errCorruptRecord
+		}
+
+		var err error
+		if op.key, payload, err = readLengthPrefixed(payload[1:]); err != nil {
+			return nil, size, err
+		}
+
+		if !op.delete {
+			if op.value, payload, err = readLengthPrefixed(payload); err != nil {
+				return nil, size, err
+			}
+		}
+
+		ops = append(ops, op)
+	}
+
+	return ops, size, nil
+}
+
+func readLengthPrefixed(data []byte) ([]byte, []byte, error) {
+	length, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < length {
+		return nil, nil, errCorruptRecord
+	}
+
+	end := n + int(length)
+	return copyBytes(data[n:end]), data[end:], nil
+}
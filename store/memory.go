@@ -0,0 +1,205 @@
+package store
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryStore is a Store that only keeps data in memory
+type MemoryStore struct {
+	values map[string][]byte
+
+	// keys are kept sorted so that scans don't need to sort them
+	keys []string
+
+	closed bool
+	l      sync.RWMutex
+}
+
+// CreateMemoryStore returns a new, empty, MemoryStore
+func CreateMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		values: make(map[string][]byte),
+		keys:   make([]string, 0),
+	}
+}
+
+// Get returns the value for key, or ErrNotFound
+func (m *MemoryStore) Get(key []byte) ([]byte, error) {
+	m.l.RLock()
+	defer m.l.RUnlock()
+
+	if m.closed {
+		return nil, ErrClosed
+	}
+
+	value, exists := m.values[string(key)]
+	if !exists {
+		return nil, ErrNotFound
+	}
+
+	return copyBytes(value), nil
+}
+
+// Put sets the value for key
+func (m *MemoryStore) Put(key []byte, value []byte) error {
+	batch := CreateBatch()
+	batch.Put(key, value)
+	return m.Write(batch)
+}
+
+// Delete removes key
+func (m *MemoryStore) Delete(key []byte) error {
+	batch := CreateBatch()
+	batch.Delete(key)
+	return m.Write(batch)
+}
+
+// Write applies all the operations in the batch atomically
+func (m *MemoryStore) Write(batch *Batch) error {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+
+	m.apply(batch.ops)
+	return nil
+}
+
+// Scan returns an Iterator over all the keys that start with prefix. The keys
+// aren't copied up front, each one is found in the store as the iterator
+// moves to it, so the iterator only holds the current key and value. It sees
+// the writes that are made to keys that it hasn't reached yet.
+//
+func (m *MemoryStore) Scan(prefix []byte) (Iterator, error) {
+	m.l.RLock()
+	defer m.l.RUnlock()
+
+	if m.closed {
+		return nil, ErrClosed
+	}
+
+	return &memoryIterator{
+		store:  m,
+		prefix: string(prefix),
+	}, nil
+}
+
+// Close empties the store
+func (m *MemoryStore) Close() error {
+	m.l.Lock()
+	m.closed = true
+	m.values = nil
+	m.keys = nil
+	m.l.Unlock()
+	return nil
+}
+
+// apply applies ops to the store
+//
+// This method is not thread safe
+//
+func (m *MemoryStore) apply(ops []batchOp) {
+	for _, op := range ops {
+		key := string(op.key)
+		_, exists := m.values[key]
+		i := sort.SearchStrings(m.keys, key)
+
+		if op.delete {
+			if exists {
+				delete(m.values, key)
+				m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			}
+
+			continue
+		}
+
+		if !exists {
+			m.keys = append(m.keys, "")
+			copy(m.keys[i+1:], m.keys[i:])
+			m.keys[i] = key
+		}
+
+		// Values are never mutated once stored, so they can be shared
+		// with iterators
+		m.values[key] = op.value
+	}
+}
+
+// memoryIterator iterates over the keys of a MemoryStore that start with
+// prefix, in order
+type memoryIterator struct {
+	store  *MemoryStore
+	prefix string
+
+	key     string
+	value   []byte
+	started bool
+	done    bool
+	err     error
+}
+
+func (it *memoryIterator) Next() bool {
+	if it.done {
+		return false
+	}
+
+	it.store.l.RLock()
+	defer it.store.l.RUnlock()
+
+	if it.store.closed {
+		it.err = ErrClosed
+		it.finish()
+		return false
+	}
+
+	keys := it.store.keys
+
+	// Find the first key after the current one, the keys may have changed
+	// since it was found
+	var i int
+	if !it.started {
+		i = sort.SearchStrings(keys, it.prefix)
+		it.started = true
+	} else {
+		i = sort.SearchStrings(keys, it.key)
+		if i < len(keys) && keys[i] == it.key {
+			i++
+		}
+	}
+
+	if i >= len(keys) || !strings.HasPrefix(keys[i], it.prefix) {
+		it.finish()
+		return false
+	}
+
+	it.key = keys[i]
+	it.value = it.store.values[it.key]
+	return true
+}
+
+func (it *memoryIterator) Key() []byte {
+	return []byte(it.key)
+}
+
+func (it *memoryIterator) Value() []byte {
+	return copyBytes(it.value)
+}
+
+func (it *memoryIterator) Err() error {
+	return it.err
+}
+
+func (it *memoryIterator) Close() error {
+	it.finish()
+	return nil
+}
+
+func (it *memoryIterator) finish() {
+	it.done = true
+	it.key = ""
+	it.value = nil
+}
@@ -0,0 +1,121 @@
+package store
+
+import "errors"
+
+var (
+	// ErrNotFound is returned when a key does not exist in the store
+	ErrNotFound = errors.New("Key not found")
+
+	// ErrClosed is returned when using a store that has been closed
+	ErrClosed = errors.New("Store is closed")
+
+	// ErrCorrupt is returned when opening a store whose data is corrupt
+	ErrCorrupt = errors.New("Store is corrupt")
+)
+
+// Store is an ordered key/value store. Keys are sorted bytewise, so all the
+// keys with a particular prefix can be scanned together.
+//
+type Store interface {
+	// Get returns the value for key, or ErrNotFound
+	Get(key []byte) ([]byte, error)
+
+	// Put sets the value for key
+	Put(key []byte, value []byte) error
+
+	// Delete removes key, it's not an error if key doesn't exist
+	Delete(key []byte) error
+
+	// Scan returns an Iterator over all the keys that start with prefix, in
+	// order. The iterator must be closed once it's no longer needed. It
+	// should find the keys lazily, so that scanning a large prefix doesn't
+	// need memory for all of it.
+	Scan(prefix []byte) (Iterator, error)
+
+	// Write applies all the operations in the batch atomically
+	Write(batch *Batch) error
+
+	// Close releases any resources held by the store
+	Close() error
+}
+
+// Iterator iterates over the keys and values from a Scan
+//
+//  it, err := s.Scan(prefix)
+//  ...
+//  defer it.Close()
+//
+//  for it.Next() {
+//    fmt.Println(it.Key(), it.Value())
+//  }
+//
+//  if err := it.Err(); err != nil {
+//    ...
+//  }
+//
+type Iterator interface {
+	// Next moves to the next key, it returns false when there are no more
+	Next() bool
+
+	// Key returns the current key
+	Key() []byte
+
+	// Value returns the current value
+	Value() []byte
+
+	// Err returns any error that stopped the iteration
+	Err() error
+
+	// Close releases the iterator
+	Close() error
+}
+
+type batchOp struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// Batch is a group of Puts and Deletes that are written to a Store
+// atomically
+//
+type Batch struct {
+	ops []batchOp
+}
+
+// CreateBatch returns a new, empty, Batch
+func CreateBatch() *Batch {
+	return &Batch{}
+}
+
+// Put adds a put of key to the batch
+func (b *Batch) Put(key []byte, value []byte) {
+	b.ops = append(b.ops, batchOp{
+		key:   copyBytes(key),
+		value: copyBytes(value),
+	})
+}
+
+// Delete adds a delete of key to the batch
+func (b *Batch) Delete(key []byte) {
+	b.ops = append(b.ops, batchOp{
+		key:    copyBytes(key),
+		delete: true,
+	})
+}
+
+// Len returns the number of operations in the batch
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// Reset removes all the operations from the batch
+func (b *Batch) Reset() {
+	b.ops = b.ops[:0]
+}
+
+func copyBytes(b []byte) []byte {
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
@@ -0,0 +1,273 @@
+package store_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/luma/pith/rapport/store"
+)
+
+func scanKeys(s Store, prefix string) []string {
+	it, err := s.Scan([]byte(prefix))
+	Expect(err).ToNot(HaveOccurred())
+	defer it.Close()
+
+	keys := make([]string, 0)
+	for it.Next() {
+		keys = append(keys, string(it.Key()))
+	}
+
+	Expect(it.Err()).ToNot(HaveOccurred())
+	return keys
+}
+
+// corruptByte flips the bits of the byte at offset in the file at path, a
+// negative offset is from the end of the file
+func corruptByte(path string, offset int64) {
+	data, err := ioutil.ReadFile(path)
+	Expect(err).ToNot(HaveOccurred())
+
+	if offset < 0 {
+		offset += int64(len(data))
+	}
+
+	data[offset] ^= 0xff
+	Expect(ioutil.WriteFile(path, data, 0644)).To(Succeed())
+}
+
+func behavesLikeAStore(create func() Store) {
+	var s Store
+
+	BeforeEach(func() {
+		s = create()
+	})
+
+	It("gets what was put", func() {
+		Expect(s.Put([]byte("a"), []byte("1"))).To(Succeed())
+
+		value, err := s.Get([]byte("a"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(value).To(Equal([]byte("1")))
+	})
+
+	It("returns ErrNotFound for missing and deleted keys", func() {
+		_, err := s.Get([]byte("a"))
+		Expect(err).To(Equal(ErrNotFound))
+
+		Expect(s.Put([]byte("a"), []byte("1"))).To(Succeed())
+		Expect(s.Delete([]byte("a"))).To(Succeed())
+
+		_, err = s.Get([]byte("a"))
+		Expect(err).To(Equal(ErrNotFound))
+	})
+
+	It("scans keys by prefix, in order", func() {
+		for _, key := range []string{"b:2", "a:1", "b:1", "c:1", "b:10"} {
+			Expect(s.Put([]byte(key), []byte(key))).To(Succeed())
+		}
+
+		Expect(scanKeys(s, "b:")).To(Equal([]string{"b:1", "b:10", "b:2"}))
+		Expect(scanKeys(s, "")).To(HaveLen(5))
+		Expect(scanKeys(s, "d")).To(BeEmpty())
+	})
+
+	It("scans lazily, seeing writes that are ahead of the iterator", func() {
+		for _, key := range []string{"a", "b", "d"} {
+			Expect(s.Put([]byte(key), []byte(key))).To(Succeed())
+		}
+
+		it, err := s.Scan(nil)
+		Expect(err).ToNot(HaveOccurred())
+		defer it.Close()
+
+		Expect(it.Next()).To(BeTrue())
+		Expect(it.Key()).To(Equal([]byte("a")))
+
+		Expect(s.Put([]byte("c"), []byte("c"))).To(Succeed())
+		Expect(s.Delete([]byte("d"))).To(Succeed())
+
+		keys := make([]string, 0)
+		for it.Next() {
+			keys = append(keys, string(it.Key()))
+		}
+
+		Expect(it.Err()).ToNot(HaveOccurred())
+		Expect(keys).To(Equal([]string{"b", "c"}))
+	})
+
+	It("writes batches", func() {
+		Expect(s.Put([]byte("a"), []byte("1"))).To(Succeed())
+
+		batch := CreateBatch()
+		batch.Put([]byte("b"), []byte("2"))
+		batch.Put([]byte("c"), []byte("3"))
+		batch.Delete([]byte("a"))
+		Expect(batch.Len()).To(Equal(3))
+
+		Expect(s.Write(batch)).To(Succeed())
+		Expect(scanKeys(s, "")).To(Equal([]string{"b", "c"}))
+	})
+
+	It("can't be used once closed", func() {
+		Expect(s.Close()).To(Succeed())
+
+		_, err := s.Get([]byte("a"))
+		Expect(err).To(Equal(ErrClosed))
+		Expect(s.Put([]byte("a"), nil)).To(Equal(ErrClosed))
+	})
+
+	It("stops scanning once closed", func() {
+		Expect(s.Put([]byte("a"), []byte("1"))).To(Succeed())
+
+		it, err := s.Scan(nil)
+		Expect(err).ToNot(HaveOccurred())
+		defer it.Close()
+
+		Expect(s.Close()).To(Succeed())
+		Expect(it.Next()).To(BeFalse())
+		Expect(it.Err()).To(Equal(ErrClosed))
+	})
+}
+
+var _ = Describe("MemoryStore", func() {
+	behavesLikeAStore(func() Store {
+		return CreateMemoryStore()
+	})
+})
+
+var _ = Describe("FileStore", func() {
+	var dir, path string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "rapport-store")
+		Expect(err).ToNot(HaveOccurred())
+		path = filepath.Join(dir, "store.log")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	open := func() *FileStore {
+		s, err := OpenFileStore(path)
+		Expect(err).ToNot(HaveOccurred())
+		return s
+	}
+
+	behavesLikeAStore(func() Store {
+		return open()
+	})
+
+	It("reloads its data when reopened", func() {
+		s := open()
+		Expect(s.Put([]byte("a"), []byte("1"))).To(Succeed())
+		Expect(s.Put([]byte("b"), []byte("2"))).To(Succeed())
+		Expect(s.Delete([]byte("a"))).To(Succeed())
+		Expect(s.Close()).To(Succeed())
+
+		s = open()
+		defer s.Close()
+		Expect(scanKeys(s, "")).To(Equal([]string{"b"}))
+	})
+
+	It("discards a partially written record", func() {
+		s := open()
+		Expect(s.Put([]byte("a"), []byte("1"))).To(Succeed())
+		Expect(s.Put([]byte("b"), []byte("2"))).To(Succeed())
+		Expect(s.Close()).To(Succeed())
+
+		info, err := os.Stat(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(os.Truncate(path, info.Size()-1)).To(Succeed())
+
+		s = open()
+		Expect(scanKeys(s, "")).To(Equal([]string{"a"}))
+
+		Expect(s.Put([]byte("c"), []byte("3"))).To(Succeed())
+		Expect(s.Close()).To(Succeed())
+
+		s = open()
+		defer s.Close()
+		Expect(scanKeys(s, "")).To(Equal([]string{"a", "c"}))
+	})
+
+	It("discards a corrupt record at the end of the log", func() {
+		s := open()
+		Expect(s.Put([]byte("a"), []byte("1"))).To(Succeed())
+		Expect(s.Put([]byte("b"), []byte("2"))).To(Succeed())
+		Expect(s.Close()).To(Succeed())
+
+		corruptByte(path, -1)
+
+		s = open()
+		defer s.Close()
+		Expect(scanKeys(s, "")).To(Equal([]string{"a"}))
+	})
+
+	It("refuses to open a log with a corrupt record before the end", func() {
+		s := open()
+		Expect(s.Put([]byte("a"), []byte("1"))).To(Succeed())
+		Expect(s.Put([]byte("b"), []byte("2"))).To(Succeed())
+		Expect(s.Close()).To(Succeed())
+
+		before, err := os.Stat(path)
+		Expect(err).ToNot(HaveOccurred())
+
+		// The last byte of the first record is the value of "a"
+		corruptByte(path, before.Size()/2-1)
+
+		_, err = OpenFileStore(path)
+		Expect(err).To(Equal(ErrCorrupt))
+
+		after, err := os.Stat(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(after.Size()).To(Equal(before.Size()))
+	})
+
+	It("refuses to open a log with a corrupt record length before the end", func() {
+		s := open()
+		Expect(s.Put([]byte("a"), []byte("1"))).To(Succeed())
+		Expect(s.Put([]byte("b"), []byte("2"))).To(Succeed())
+		Expect(s.Close()).To(Succeed())
+
+		before, err := os.Stat(path)
+		Expect(err).ToNot(HaveOccurred())
+
+		// The length of the first record follows it's checksum
+		corruptByte(path, 4)
+
+		_, err = OpenFileStore(path)
+		Expect(err).To(Equal(ErrCorrupt))
+
+		after, err := os.Stat(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(after.Size()).To(Equal(before.Size()))
+	})
+
+	It("compacts the log", func() {
+		s := open()
+		for i := 0; i < 10; i++ {
+			Expect(s.Put([]byte("a"), []byte("value"))).To(Succeed())
+		}
+
+		before, err := os.Stat(path)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(s.Compact()).To(Succeed())
+		Expect(s.Put([]byte("b"), []byte("2"))).To(Succeed())
+		Expect(s.Close()).To(Succeed())
+
+		after, err := os.Stat(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(after.Size()).To(BeNumerically("<", before.Size()))
+
+		s = open()
+		defer s.Close()
+		Expect(scanKeys(s, "")).To(Equal([]string{"a", "b"}))
+	})
+})
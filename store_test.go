@@ -0,0 +1,69 @@
+package rapport_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/luma/pith/rapport"
+	"github.com/luma/pith/rapport/store"
+)
+
+var _ = Describe("Store helpers", func() {
+	var s *store.MemoryStore
+
+	BeforeEach(func() {
+		s = store.CreateMemoryStore()
+	})
+
+	It("saves and loads a value", func() {
+		set := CreateAWSet()
+		set.Add([]string{"foo", "bar"}, "a")
+		Expect(SaveValue(s, []byte("set"), set)).To(Succeed())
+
+		loaded := CreateAWSet()
+		Expect(LoadValue(s, []byte("set"), loaded)).To(Succeed())
+		Expect(loaded.Values()).To(ConsistOf("foo", "bar"))
+	})
+
+	It("deletes segments the value no longer has", func() {
+		set := CreateAWSet()
+		set.Add([]string{"foo", "bar"}, "a")
+		Expect(SaveValue(s, []byte("set"), set)).To(Succeed())
+
+		set.RemoveOne("foo")
+		Expect(SaveValue(s, []byte("set"), set)).To(Succeed())
+
+		it, err := s.Scan(SegmentKey([]byte("set"), nil))
+		Expect(err).ToNot(HaveOccurred())
+		defer it.Close()
+
+		count := 0
+		for it.Next() {
+			count++
+		}
+
+		// The header and the entry for "bar"
+		Expect(count).To(Equal(2))
+
+		loaded := CreateAWSet()
+		Expect(LoadValue(s, []byte("set"), loaded)).To(Succeed())
+		Expect(loaded.Values()).To(ConsistOf("bar"))
+	})
+
+	It("keeps the segments of keys that share a prefix apart", func() {
+		a := CreatePNCounter("a")
+		a.IncrBy(2)
+		b := CreatePNCounter("b")
+		b.IncrBy(5)
+
+		Expect(SaveValue(s, []byte("hits"), a)).To(Succeed())
+		Expect(SaveValue(s, []byte("hits-today"), b)).To(Succeed())
+		Expect(DeleteValue(s, []byte("hits-today"))).To(Succeed())
+
+		loaded := CreatePNCounter("a")
+		Expect(LoadValue(s, []byte("hits"), loaded)).To(Succeed())
+		Expect(loaded.Value()).To(Equal(int64(2)))
+
+		Expect(LoadValue(s, []byte("hits-today"), loaded)).To(Equal(store.ErrNotFound))
+	})
+})
@@ -0,0 +1,244 @@
+package rapport
+
+import (
+	"fmt"
+
+	"github.com/luma/pith/keys"
+	"github.com/luma/pith/rapport/causality"
+)
+
+var (
+	// AddedKey is the sigil used to deliminate a key that is for a 2P-Set's
+	// added values
+	AddedKey = []byte("A")
+
+	// RemovedKey is the sigil used to deliminate a key that is for a 2P-Set's
+	// removed values
+	RemovedKey = []byte("R")
+)
+
+// TwoPhaseSet is a Two-Phase Set (2P-Set). It consists of two G-Sets; one to
+// track additions and another to track removals. Once a value has been removed
+// it can never be re-added.
+//
+type TwoPhaseSet struct {
+	added   *GSet
+	removed *GSet
+}
+
+// CreateTwoPhaseSet returns a new, empty TwoPhaseSet.
+//
+func CreateTwoPhaseSet() *TwoPhaseSet {
+	return &TwoPhaseSet{
+		added:   CreateGSet(),
+		removed: CreateGSet(),
+	}
+}
+
+// AddOne adds a single element to the set. It returns true if the element was
+// added, otherwise it returns false. Elements that have been removed cannot be
+// added again.
+//
+// The replica is unused as a 2P-Set does not track causality, it's accepted
+// so that TwoPhaseSet satisfies the Set contract.
+//
+func (t *TwoPhaseSet) AddOne(value string, replica string) bool {
+	if t.removed.Contains(value) {
+		return false
+	}
+
+	return t.added.AddOne(value)
+}
+
+// Add adds multiple elements to the set. It returns the number of elements
+// that were added.
+//
+func (t *TwoPhaseSet) Add(values []string, replica string) int {
+	added := 0
+
+	for _, value := range values {
+		if t.AddOne(value, replica) {
+			added++
+		}
+	}
+
+	return added
+}
+
+// RemoveOne removes a single element from the set by value. Only values that
+// are currently in the set can be removed.
+//
+// A 2P-Set does not track causality so the VersionVector that is returned is
+// always empty, it will be nil if nothing was removed.
+//
+func (t *TwoPhaseSet) RemoveOne(value string) *causality.VersionVector {
+	if !t.Contains(value) {
+		return nil
+	}
+
+	t.removed.AddOne(value)
+	return causality.CreateVersionVector()
+}
+
+// Remove removes a number of values from the set and returns the number
+// of elements that were removed.
+//
+func (t *TwoPhaseSet) Remove(values []string) int {
+	removed := 0
+
+	for _, value := range values {
+		if t.RemoveOne(value) != nil {
+			removed++
+		}
+	}
+
+	return removed
+}
+
+// Values returns the set elements
+func (t *TwoPhaseSet) Values() []string {
+	values := make([]string, 0, t.added.Cardinality())
+
+	t.Each(func(value string) {
+		values = append(values, value)
+	})
+
+	return values
+}
+
+// Cardinality returns the number of elements in the set
+func (t *TwoPhaseSet) Cardinality() int {
+	count := 0
+
+	t.Each(func(value string) {
+		count++
+	})
+
+	return count
+}
+
+// IsEmpty returns true if the set contains no elements
+func (t *TwoPhaseSet) IsEmpty() bool {
+	return t.Cardinality() == 0
+}
+
+// Contains returns true if the value is in the set
+func (t *TwoPhaseSet) Contains(value string) bool {
+	return t.added.Contains(value) && !t.removed.Contains(value)
+}
+
+// Each iterates over the set calling the provided function at each iteraction
+func (t *TwoPhaseSet) Each(fn func(string)) {
+	t.added.Each(func(value string) {
+		if !t.removed.Contains(value) {
+			fn(value)
+		}
+	})
+}
+
+// Union returns a new set that is the union between this
+// set and the other
+func (t *TwoPhaseSet) Union(other Set, replica string) Set {
+	union := CreateTwoPhaseSet()
+	union.Add(t.Values(), replica)
+	union.Add(other.Values(), replica)
+	return union
+}
+
+// Intersect returns a new set that is the intersection between this
+// set and the other
+func (t *TwoPhaseSet) Intersect(other Set, replica string) Set {
+	intersection := CreateTwoPhaseSet()
+
+	t.Each(func(value string) {
+		if other.Contains(value) {
+			intersection.AddOne(value, replica)
+		}
+	})
+
+	return intersection
+}
+
+// IsSubsetOf indicates whether this set is a subset of the other
+func (t *TwoPhaseSet) IsSubsetOf(other Set) bool {
+	for _, value := range t.Values() {
+		if !other.Contains(value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Difference returns a new set that is the difference between this
+// set and the other
+func (t *TwoPhaseSet) Difference(other Set) []string {
+	diff := make([]string, 0)
+
+	for _, value := range t.Values() {
+		if !other.Contains(value) {
+			diff = append(diff, value)
+		}
+	}
+
+	return diff
+}
+
+// Merge another TwoPhaseSet into this one
+//
+func (t *TwoPhaseSet) Merge(crdt CRDT) {
+	other := crdt.(*TwoPhaseSet)
+
+	t.added.Merge(other.added)
+	t.removed.Merge(other.removed)
+}
+
+// Marshal serialises the set data to bytes
+func (t *TwoPhaseSet) Marshal() ([]*Segment, error) {
+	added := t.added.Values()
+	removed := t.removed.Values()
+
+	segments := make([]*Segment, 0, 1+len(added)+len(removed))
+
+	// The header segment carries no data, but means that an empty set still
+	// produces a segment
+	segments = append(segments, &Segment{})
+
+	for _, value := range added {
+		segments = append(segments, &Segment{
+			KeySuffix: keys.Make(AddedKey, []byte(value)),
+		})
+	}
+
+	for _, value := range removed {
+		segments = append(segments, &Segment{
+			KeySuffix: keys.Make(RemovedKey, []byte(value)),
+		})
+	}
+
+	return segments, nil
+}
+
+// Unmarshal deserialises the set data from bytes
+func (t *TwoPhaseSet) Unmarshal(data []*Segment) error {
+	added := CreateGSet()
+	removed := CreateGSet()
+
+	for _, s := range data[1:] {
+		// Strip off the key sigil to get the value
+		value := string(s.KeySuffix[2:])
+
+		if s.KeySuffix[0] == AddedKey[0] {
+			added.AddOne(value)
+		} else if s.KeySuffix[0] == RemovedKey[0] {
+			removed.AddOne(value)
+		} else {
+			return fmt.Errorf("Unexpected key suffix for set: %s", s.KeySuffix)
+		}
+	}
+
+	t.added = added
+	t.removed = removed
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package rapport_test
+
+import (
+	"sort"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/luma/pith/rapport"
+)
+
+var _ = Describe("TwoPhaseSet", func() {
+	var set *TwoPhaseSet
+
+	JustBeforeEach(func() {
+		set = CreateTwoPhaseSet()
+		set.AddOne("foo", "replica1")
+	})
+
+	It("satisfies the Set contract", func() {
+		var s Set = set
+		Expect(s.Contains("foo")).To(BeTrue())
+	})
+
+	Describe("AddOne()", func() {
+		It("adds the value", func() {
+			Expect(set.Contains("foo")).To(BeTrue())
+			Expect(set.Cardinality()).To(Equal(1))
+		})
+
+		It("returns false when the value is already in the set", func() {
+			Expect(set.AddOne("foo", "replica1")).To(BeFalse())
+		})
+	})
+
+	Describe("RemoveOne()", func() {
+		It("removes the value", func() {
+			Expect(set.RemoveOne("foo")).ToNot(BeNil())
+			Expect(set.Contains("foo")).To(BeFalse())
+			Expect(set.IsEmpty()).To(BeTrue())
+		})
+
+		It("returns nil when the value is not in the set", func() {
+			Expect(set.RemoveOne("wut")).To(BeNil())
+		})
+
+		It("prevents the value from being re-added", func() {
+			set.RemoveOne("foo")
+			Expect(set.AddOne("foo", "replica1")).To(BeFalse())
+			Expect(set.Contains("foo")).To(BeFalse())
+		})
+	})
+
+	Describe("Remove()", func() {
+		It("returns how many elements were removed", func() {
+			set.Add([]string{"bar", "baz"}, "replica1")
+			Expect(set.Remove([]string{"foo", "bar", "wut"})).To(Equal(2))
+			Expect(set.Values()).To(Equal([]string{"baz"}))
+		})
+	})
+
+	Describe("Merge()", func() {
+		It("merges additions from both sets", func() {
+			set2 := CreateTwoPhaseSet()
+			set2.Add([]string{"bar", "baz"}, "replica2")
+
+			set.Merge(set2)
+
+			values := set.Values()
+			sort.Strings(values)
+			Expect(values).To(Equal([]string{"bar", "baz", "foo"}))
+		})
+
+		It("removals win over concurrent additions", func() {
+			set2 := CreateTwoPhaseSet()
+			set2.Merge(set)
+			set2.RemoveOne("foo")
+			set.AddOne("foo", "replica1")
+
+			set.Merge(set2)
+			set2.Merge(set)
+
+			Expect(set.Contains("foo")).To(BeFalse())
+			Expect(set2.Contains("foo")).To(BeFalse())
+		})
+	})
+
+	Describe("Marshal()", func() {
+		It("round trips through Unmarshal()", func() {
+			set.Add([]string{"bar", "baz"}, "replica1")
+			set.RemoveOne("bar")
+
+			segments, err := set.Marshal()
+			Expect(err).ToNot(HaveOccurred())
+
+			set2 := CreateTwoPhaseSet()
+			Expect(set2.Unmarshal(segments)).To(Succeed())
+
+			values := set2.Values()
+			sort.Strings(values)
+			Expect(values).To(Equal([]string{"baz", "foo"}))
+			Expect(set2.AddOne("bar", "replica1")).To(BeFalse())
+		})
+	})
+})